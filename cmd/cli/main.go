@@ -16,6 +16,7 @@ func main() {
 	err := relaybaton.RootCmd.Execute()
 	if err != nil {
 		log.Error(err)
+		os.Exit(1)
 	}
 }
 
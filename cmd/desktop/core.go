@@ -147,7 +147,7 @@ func SaveConfFile(filePath *C.char,
 	if err != nil {
 		return C.CString(err.Error())
 	}
-	confGo.Client, err = conf.Client.Init()
+	err = confGo.InitClient()
 	if err != nil {
 		return C.CString(err.Error())
 	}
@@ -8,7 +8,6 @@ import (
 
 	tun2socks "github.com/eycorsican/go-tun2socks/core"
 	"github.com/eycorsican/go-tun2socks/proxy/socks"
-	"github.com/go-playground/validator/v10"
 	"github.com/iyouport-org/relaybaton/pkg/config"
 	"github.com/iyouport-org/relaybaton/pkg/core"
 	"github.com/panjf2000/gnet/pool/goroutine"
@@ -47,7 +46,6 @@ func NewAndroid(conf string) (*RelaybatonAndroid, error) {
 	log.SetLevel(log.TraceLevel)
 
 	ra := &RelaybatonAndroid{}
-	validate := validator.New()
 	v := viper.New()
 	v.SetConfigType("toml")
 	err = v.ReadConfig(bytes.NewBufferString(conf))
@@ -66,12 +64,7 @@ func NewAndroid(conf string) (*RelaybatonAndroid, error) {
 		log.Error(err)
 		return nil, &AndroidError{err}
 	}
-	err = validate.Struct(confTOML.Client)
-	if err != nil {
-		log.Error(err)
-		return nil, &AndroidError{err}
-	}
-	ra.conf.Client, err = confTOML.Client.Init()
+	err = ra.conf.InitClient()
 	if err != nil {
 		log.Error(err)
 		return nil, &AndroidError{err}
@@ -138,7 +131,7 @@ func (android *RelaybatonAndroid) Save(clientServer string, clientUser string, c
 		log.Error(err)
 		return &AndroidError{err}
 	}
-	conf.Client, err = confTOML.Client.Init()
+	err = conf.InitClient()
 	if err != nil {
 		log.Error(err)
 		return &AndroidError{err}
@@ -163,31 +156,31 @@ func (android *RelaybatonAndroid) Shutdown() error {
 }
 
 func (android *RelaybatonAndroid) GetClientServer() string {
-	return android.conf.Client.Server
+	return android.conf.Client().Server
 }
 
 func (android *RelaybatonAndroid) GetClientUsername() string {
-	return android.conf.Client.Username
+	return android.conf.Client().Username
 }
 
 func (android *RelaybatonAndroid) GetClientPassword() string {
-	return android.conf.Client.Password
+	return android.conf.Client().Password
 }
 
 func (android *RelaybatonAndroid) GetClientProxyAll() bool {
-	return android.conf.Client.ProxyAll
+	return android.conf.Client().ProxyAll
 }
 
 func (android *RelaybatonAndroid) GetDNSType() string {
-	return string(android.conf.DNS.Type)
+	return string(android.conf.DNS().Type)
 }
 
 func (android *RelaybatonAndroid) GetDNSServer() string {
-	return android.conf.DNS.Server
+	return android.conf.DNS().Server
 }
 
 func (android *RelaybatonAndroid) GetDNSAddr() string {
-	return android.conf.DNS.Addr.String()
+	return android.conf.DNS().Addr.String()
 }
 
 func (android *RelaybatonAndroid) GetLogLevel() string {
@@ -0,0 +1,114 @@
+package relaybaton
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iyouport-org/relaybaton/pkg/config"
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// initAdminCmd adds the --output flag to the subcommands of cmd.
+// Once the arguments are parsed, errors are printed without the usage.
+func initAdminCmd(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringP("output", "o", outputTable, "output format, table or json")
+	cmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		cmd.SilenceUsage = true
+	}
+}
+
+// openDB loads the server configuration and connects to its database
+func openDB() (*config.ConfigGo, *gorm.DB, error) {
+	conf, err := config.NewConfServer()
+	if err != nil {
+		return nil, nil, err
+	}
+	return conf, conf.DB.DB, nil
+}
+
+// printResult writes v as JSON, or the rows as a table under header, depending on the --output flag
+func printResult(cmd *cobra.Command, v interface{}, header []string, rows [][]string) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	switch output {
+	case outputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case outputTable:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		return w.Flush()
+	default:
+		return errors.New("unknown output format: " + output)
+	}
+}
+
+// findUser looks up a user by ID or username
+func findUser(db *gorm.DB, s string) (*model.User, error) {
+	user := &model.User{}
+	query := db.Preload("Plan")
+	if id, err := strconv.ParseUint(s, 10, 64); err == nil {
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Where("username = ?", s)
+	}
+	err := query.First(user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("user not found: " + s)
+	}
+	return user, err
+}
+
+// findPlan looks up a plan by ID or name
+func findPlan(db *gorm.DB, s string) (*model.Plan, error) {
+	plan := &model.Plan{}
+	query := db
+	if id, err := strconv.ParseUint(s, 10, 64); err == nil {
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Where("name = ?", s)
+	}
+	err := query.First(plan).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("plan not found: " + s)
+	}
+	return plan, err
+}
+
+// readSecret reads a line from the standard input, so that secrets are kept out of the shell history
+func readSecret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func formatTime(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func formatUint(n uint) string {
+	return strconv.FormatUint(uint64(n), 10)
+}
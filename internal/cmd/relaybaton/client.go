@@ -38,6 +38,7 @@ func clientExec(cmd *cobra.Command, args []string) {
 	if err != nil {
 		log.Error(err)
 	}
+	client.ConfigGo.Watch(client.ApplyConfig)
 	err = client.Run()
 	if err != nil {
 		log.Error(err)
@@ -0,0 +1,99 @@
+package relaybaton
+
+import (
+	"fmt"
+
+	"github.com/iyouport-org/relaybaton/pkg/config"
+	"github.com/iyouport-org/relaybaton/pkg/migration"
+	"github.com/spf13/cobra"
+)
+
+var DBCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the schema of the server database",
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply the pending migrations",
+	Args:  cobra.NoArgs,
+	RunE:  dbMigrateExec,
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List the migrations and whether they are applied",
+	Args:  cobra.NoArgs,
+	RunE:  dbStatusExec,
+}
+
+var dbRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Revert the last applied migrations",
+	Args:  cobra.NoArgs,
+	RunE:  dbRollbackExec,
+}
+
+func init() {
+	initAdminCmd(DBCmd)
+	dbRollbackCmd.Flags().Int("steps", 1, "number of migrations to revert")
+	DBCmd.AddCommand(dbMigrateCmd, dbStatusCmd, dbRollbackCmd)
+}
+
+func printMigrations(cmd *cobra.Command, migrations []migration.Migration) error {
+	statuses := make([]migration.Status, len(migrations))
+	rows := make([][]string, len(migrations))
+	for k, m := range migrations {
+		statuses[k] = migration.Status{
+			Version:     m.Version,
+			Description: m.Description,
+		}
+		rows[k] = []string{formatUint(m.Version), m.Description}
+	}
+	return printResult(cmd, statuses, []string{"VERSION", "DESCRIPTION"}, rows)
+}
+
+func dbMigrateExec(cmd *cobra.Command, args []string) error {
+	conf, err := config.NewConfDB()
+	if err != nil {
+		return err
+	}
+	done, err := migration.Migrate(conf.DB.DB)
+	if err != nil {
+		return err
+	}
+	return printMigrations(cmd, done)
+}
+
+func dbStatusExec(cmd *cobra.Command, args []string) error {
+	conf, err := config.NewConfDB()
+	if err != nil {
+		return err
+	}
+	statuses, err := migration.Statuses(conf.DB.DB)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, len(statuses))
+	for k, status := range statuses {
+		appliedAt := ""
+		if status.AppliedAt != nil {
+			appliedAt = formatTime(*status.AppliedAt)
+		}
+		rows[k] = []string{formatUint(status.Version), status.Description, fmt.Sprint(status.Applied), appliedAt}
+	}
+	return printResult(cmd, statuses, []string{"VERSION", "DESCRIPTION", "APPLIED", "APPLIED_AT"}, rows)
+}
+
+func dbRollbackExec(cmd *cobra.Command, args []string) error {
+	steps, _ := cmd.Flags().GetInt("steps")
+	conf, err := config.NewConfDB()
+	if err != nil {
+		return err
+	}
+	done, err := migration.Rollback(conf.DB.DB, steps)
+	if err != nil {
+		return err
+	}
+	return printMigrations(cmd, done)
+}
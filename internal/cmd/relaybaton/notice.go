@@ -0,0 +1,74 @@
+package relaybaton
+
+import (
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	"github.com/iyouport-org/relaybaton/pkg/webapi"
+	"github.com/spf13/cobra"
+)
+
+var NoticeCmd = &cobra.Command{
+	Use:   "notice",
+	Short: "Manage the notices shown to the users",
+}
+
+var noticeAddCmd = &cobra.Command{
+	Use:   "add <title>",
+	Short: "Add a notice",
+	Args:  cobra.ExactArgs(1),
+	RunE:  noticeAddExec,
+}
+
+var noticeListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the notices",
+	Args:  cobra.NoArgs,
+	RunE:  noticeListExec,
+}
+
+func init() {
+	initAdminCmd(NoticeCmd)
+	noticeAddCmd.Flags().String("text", "", "text of the notice")
+	NoticeCmd.AddCommand(noticeAddCmd, noticeListCmd)
+}
+
+func printNotices(cmd *cobra.Command, notices []model.Notice) error {
+	rows := make([][]string, len(notices))
+	for k, notice := range notices {
+		rows[k] = []string{
+			formatUint(notice.ID),
+			notice.Title,
+			formatTime(notice.CreatedAt),
+		}
+	}
+	return printResult(cmd, webapi.GetNotices(notices), []string{"ID", "TITLE", "CREATED"}, rows)
+}
+
+func noticeAddExec(cmd *cobra.Command, args []string) error {
+	text, _ := cmd.Flags().GetString("text")
+	_, db, err := openDB()
+	if err != nil {
+		return err
+	}
+	notice := &model.Notice{
+		Title: args[0],
+		Text:  text,
+	}
+	err = db.Create(notice).Error
+	if err != nil {
+		return err
+	}
+	return printNotices(cmd, []model.Notice{*notice})
+}
+
+func noticeListExec(cmd *cobra.Command, args []string) error {
+	_, db, err := openDB()
+	if err != nil {
+		return err
+	}
+	var notices []model.Notice
+	err = db.Order("id").Find(&notices).Error
+	if err != nil {
+		return err
+	}
+	return printNotices(cmd, notices)
+}
@@ -0,0 +1,222 @@
+package relaybaton
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iyouport-org/relaybaton/pkg/config"
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	"github.com/iyouport-org/relaybaton/pkg/util"
+	"github.com/iyouport-org/relaybaton/pkg/webapi"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var PlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Manage the plans in the server database",
+}
+
+var planAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add a plan",
+	Args:  cobra.ExactArgs(1),
+	RunE:  planAddExec,
+}
+
+var planListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the plans",
+	Args:  cobra.NoArgs,
+	RunE:  planListExec,
+}
+
+var planEditCmd = &cobra.Command{
+	Use:   "edit <name|id>",
+	Short: "Change the given settings of a plan",
+	Args:  cobra.ExactArgs(1),
+	RunE:  planEditExec,
+}
+
+// planFlags maps the flags of plan add and plan edit to the columns of the plans table
+var planFlags = map[string]string{
+	"name":               "name",
+	"bandwidth":          "bandwidth_limit",
+	"traffic":            "traffic_limit",
+	"max-connections":    "max_connections",
+	"max-devices":        "max_devices",
+	"cycle-days":         "cycle_days",
+	"duration-days":      "duration_days",
+	"expired-plan":       "expired_plan_id",
+	"allow-udp":          "allow_udp",
+	"ports":              "port_ranges",
+	"blocked-categories": "blocked_categories",
+	"max-duration":       "max_duration",
+}
+
+func init() {
+	initAdminCmd(PlanCmd)
+	addPlanFlags(planAddCmd.Flags())
+	addPlanFlags(planEditCmd.Flags())
+	planEditCmd.Flags().String("name", "", "new name of the plan")
+	PlanCmd.AddCommand(planAddCmd, planListCmd, planEditCmd)
+}
+
+func addPlanFlags(flags *pflag.FlagSet) {
+	flags.Uint("bandwidth", 0, "bandwidth limit in KB/s, 0 for unlimited")
+	flags.Uint("traffic", 0, "traffic limit of each cycle")
+	flags.Uint("max-connections", 0, "concurrent tunnels per user, 0 for unlimited")
+	flags.Uint("max-devices", 0, "distinct client IPs per user, 0 for unlimited")
+	flags.Uint("cycle-days", 0, "days between traffic resets, 0 for never")
+	flags.Uint("duration-days", 0, "days before the plan expires, 0 for never")
+	flags.Uint("expired-plan", 0, "plan to downgrade to when expired, 0 to disable the user")
+	flags.Bool("allow-udp", false, "allow UDP")
+	flags.StringSlice("ports", nil, "allowed destination ports or port ranges, empty for all")
+	flags.StringSlice("blocked-categories", nil, "blocked destination categories defined in server.categories")
+	flags.Uint("max-duration", 0, "seconds a tunnel can last, 0 for unlimited")
+}
+
+// checkPlan validates the port ranges and the categories of the plan against the server configuration
+func checkPlan(conf *config.ConfigGo, plan *model.Plan) error {
+	for _, s := range strings.Split(plan.PortRanges, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		if _, err := util.ParsePortRange(s); err != nil {
+			return err
+		}
+	}
+	for _, category := range plan.BlockedCategoryList() {
+		if _, ok := conf.Server().Categories[category]; !ok {
+			return fmt.Errorf("unknown category: %s", category)
+		}
+	}
+	return nil
+}
+
+// readPlanFlags sets the fields of plan from the flags which are given, it returns the columns which are set
+func readPlanFlags(flags *pflag.FlagSet, plan *model.Plan) (columns []string, err error) {
+	flags.Visit(func(f *pflag.Flag) {
+		column, ok := planFlags[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		switch f.Name {
+		case "name":
+			plan.Name, err = flags.GetString(f.Name)
+		case "bandwidth":
+			plan.BandwidthLimit, err = flags.GetUint(f.Name)
+		case "traffic":
+			plan.TrafficLimit, err = flags.GetUint(f.Name)
+		case "max-connections":
+			plan.MaxConnections, err = flags.GetUint(f.Name)
+		case "max-devices":
+			plan.MaxDevices, err = flags.GetUint(f.Name)
+		case "cycle-days":
+			plan.CycleDays, err = flags.GetUint(f.Name)
+		case "duration-days":
+			plan.DurationDays, err = flags.GetUint(f.Name)
+		case "expired-plan":
+			plan.ExpiredPlanID, err = flags.GetUint(f.Name)
+		case "allow-udp":
+			plan.AllowUDP, err = flags.GetBool(f.Name)
+		case "ports":
+			var ports []string
+			ports, err = flags.GetStringSlice(f.Name)
+			plan.PortRanges = strings.Join(ports, ",")
+		case "blocked-categories":
+			var categories []string
+			categories, err = flags.GetStringSlice(f.Name)
+			plan.BlockedCategories = strings.Join(categories, ",")
+		case "max-duration":
+			plan.MaxDuration, err = flags.GetUint(f.Name)
+		}
+		columns = append(columns, column)
+	})
+	return columns, err
+}
+
+func printPlans(cmd *cobra.Command, plans []model.Plan) error {
+	rows := make([][]string, len(plans))
+	for k, plan := range plans {
+		rows[k] = []string{
+			formatUint(plan.ID),
+			plan.Name,
+			formatUint(plan.BandwidthLimit),
+			formatUint(plan.TrafficLimit),
+			formatUint(plan.MaxConnections),
+			formatUint(plan.MaxDevices),
+			formatUint(plan.CycleDays),
+			formatUint(plan.DurationDays),
+			formatUint(plan.ExpiredPlanID),
+			fmt.Sprint(plan.AllowUDP),
+			plan.PortRanges,
+			plan.BlockedCategories,
+			formatUint(plan.MaxDuration),
+		}
+	}
+	return printResult(cmd, webapi.GetPlans(plans), []string{"ID", "NAME", "BANDWIDTH", "TRAFFIC", "CONNECTIONS", "DEVICES", "CYCLE", "DURATION", "EXPIRED_PLAN", "UDP", "PORTS", "BLOCKED", "MAX_DURATION"}, rows)
+}
+
+func planAddExec(cmd *cobra.Command, args []string) error {
+	conf, db, err := openDB()
+	if err != nil {
+		return err
+	}
+	plan := &model.Plan{
+		Name: args[0],
+	}
+	_, err = readPlanFlags(cmd.Flags(), plan)
+	if err != nil {
+		return err
+	}
+	err = checkPlan(conf, plan)
+	if err != nil {
+		return err
+	}
+	err = db.Create(plan).Error
+	if err != nil {
+		return err
+	}
+	return printPlans(cmd, []model.Plan{*plan})
+}
+
+func planListExec(cmd *cobra.Command, args []string) error {
+	_, db, err := openDB()
+	if err != nil {
+		return err
+	}
+	var plans []model.Plan
+	err = db.Order("id").Find(&plans).Error
+	if err != nil {
+		return err
+	}
+	return printPlans(cmd, plans)
+}
+
+func planEditExec(cmd *cobra.Command, args []string) error {
+	conf, db, err := openDB()
+	if err != nil {
+		return err
+	}
+	plan, err := findPlan(db, args[0])
+	if err != nil {
+		return err
+	}
+	columns, err := readPlanFlags(cmd.Flags(), plan)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return printPlans(cmd, []model.Plan{*plan})
+	}
+	err = checkPlan(conf, plan)
+	if err != nil {
+		return err
+	}
+	err = db.Model(plan).Select(columns).Updates(plan).Error
+	if err != nil {
+		return err
+	}
+	return printPlans(cmd, []model.Plan{*plan})
+}
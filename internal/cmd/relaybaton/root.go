@@ -12,4 +12,9 @@ func init() {
 	RootCmd.PersistentFlags().String("config", "", "TODO")
 	RootCmd.AddCommand(ClientCmd)
 	RootCmd.AddCommand(ServerCmd)
+	RootCmd.AddCommand(UserCmd)
+	RootCmd.AddCommand(PlanCmd)
+	RootCmd.AddCommand(NoticeCmd)
+	RootCmd.AddCommand(DBCmd)
+	RootCmd.AddCommand(SessionKeyCmd)
 }
@@ -35,5 +35,6 @@ func serverExec(cmd *cobra.Command, args []string) {
 	if err != nil {
 		log.Error(err)
 	}
+	server.ConfigGo.Watch(server.ApplyConfig)
 	server.Run()
 }
@@ -0,0 +1,97 @@
+package relaybaton
+
+import (
+	"errors"
+
+	"github.com/iyouport-org/relaybaton/pkg/core"
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var SessionKeyCmd = &cobra.Command{
+	Use:   "session-key",
+	Short: "Manage the session keys kept in the server database when server.session_keys is not set",
+}
+
+var sessionKeyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the session keys, newest first",
+	Args:  cobra.NoArgs,
+	RunE:  sessionKeyListExec,
+}
+
+var sessionKeyRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Add a new session key and delete the oldest ones, the servers sign with the new key once restarted",
+	Args:  cobra.NoArgs,
+	RunE:  sessionKeyRotateExec,
+}
+
+type sessionKeyInfo struct {
+	ID        uint   `json:"id"`
+	CreatedAt string `json:"created_at"`
+}
+
+func init() {
+	initAdminCmd(SessionKeyCmd)
+	sessionKeyRotateCmd.Flags().Int("keep", 2, "number of keys to keep including the new one, older keys stop verifying sessions")
+	SessionKeyCmd.AddCommand(sessionKeyListCmd, sessionKeyRotateCmd)
+}
+
+func printSessionKeys(cmd *cobra.Command, db *gorm.DB) error {
+	var keys []model.SessionKey
+	err := db.Order("id DESC").Find(&keys).Error
+	if err != nil {
+		return err
+	}
+	infos := make([]sessionKeyInfo, len(keys))
+	rows := make([][]string, len(keys))
+	for k, key := range keys {
+		infos[k] = sessionKeyInfo{
+			ID:        key.ID,
+			CreatedAt: formatTime(key.CreatedAt),
+		}
+		rows[k] = []string{formatUint(key.ID), infos[k].CreatedAt}
+	}
+	return printResult(cmd, infos, []string{"ID", "CREATED"}, rows)
+}
+
+func sessionKeyListExec(cmd *cobra.Command, args []string) error {
+	_, db, err := openDB()
+	if err != nil {
+		return err
+	}
+	return printSessionKeys(cmd, db)
+}
+
+func sessionKeyRotateExec(cmd *cobra.Command, args []string) error {
+	keep, _ := cmd.Flags().GetInt("keep")
+	if keep < 1 {
+		return errors.New("--keep must be at least 1")
+	}
+	_, db, err := openDB()
+	if err != nil {
+		return err
+	}
+	key, err := core.NewSessionKey()
+	if err != nil {
+		return err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(key).Error
+		if err != nil {
+			return err
+		}
+		var keys []model.SessionKey
+		err = tx.Order("id DESC").Find(&keys).Error
+		if err != nil || len(keys) <= keep {
+			return err
+		}
+		return tx.Unscoped().Delete(keys[keep:]).Error
+	})
+	if err != nil {
+		return err
+	}
+	return printSessionKeys(cmd, db)
+}
@@ -0,0 +1,224 @@
+package relaybaton
+
+import (
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	"github.com/iyouport-org/relaybaton/pkg/webapi"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var UserCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage the users in the server database",
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add <username>",
+	Short: "Add a user, the password is read from the standard input unless --password is given",
+	Args:  cobra.ExactArgs(1),
+	RunE:  userAddExec,
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the users",
+	Args:  cobra.NoArgs,
+	RunE:  userListExec,
+}
+
+var userShowCmd = &cobra.Command{
+	Use:   "show <username|id>",
+	Short: "Show a user",
+	Args:  cobra.ExactArgs(1),
+	RunE:  userShowExec,
+}
+
+var userDeleteCmd = &cobra.Command{
+	Use:   "delete <username|id>",
+	Short: "Delete a user",
+	Args:  cobra.ExactArgs(1),
+	RunE:  userDeleteExec,
+}
+
+var userSetPlanCmd = &cobra.Command{
+	Use:   "set-plan <username|id> <plan name|id>",
+	Short: "Subscribe a user to a plan from now on",
+	Args:  cobra.ExactArgs(2),
+	RunE:  userSetPlanExec,
+}
+
+var userResetTrafficCmd = &cobra.Command{
+	Use:   "reset-traffic <username|id>",
+	Short: "Reset the traffic used by a user",
+	Args:  cobra.ExactArgs(1),
+	RunE:  userResetTrafficExec,
+}
+
+func init() {
+	initAdminCmd(UserCmd)
+	userAddCmd.Flags().String("password", "", "password of the user")
+	userAddCmd.Flags().String("plan", "1", "plan name or id")
+	userAddCmd.Flags().Bool("admin", false, "grant the admin role")
+	UserCmd.AddCommand(userAddCmd, userListCmd, userShowCmd, userDeleteCmd, userSetPlanCmd, userResetTrafficCmd)
+}
+
+func printUsers(cmd *cobra.Command, users []model.User) error {
+	rows := make([][]string, len(users))
+	for k, user := range users {
+		role := "user"
+		if user.Role == model.RoleAdmin {
+			role = "admin"
+		}
+		rows[k] = []string{
+			formatUint(user.ID),
+			user.Username,
+			role,
+			user.Plan.Name,
+			formatUint(user.TrafficUsed) + "/" + formatUint(user.Plan.TrafficLimit),
+			formatTime(user.PlanReset),
+			formatTime(user.PlanEnd),
+			fmt.Sprint(user.Disabled),
+		}
+	}
+	return printResult(cmd, webapi.GetUsers(users), []string{"ID", "USERNAME", "ROLE", "PLAN", "TRAFFIC", "RESET", "END", "DISABLED"}, rows)
+}
+
+func userAddExec(cmd *cobra.Command, args []string) error {
+	username := args[0]
+	if username == "admin" {
+		return errors.New("username reserved: admin")
+	}
+	password, _ := cmd.Flags().GetString("password")
+	planName, _ := cmd.Flags().GetString("plan")
+	admin, _ := cmd.Flags().GetBool("admin")
+	var err error
+	if password == "" {
+		password, err = readSecret("Password: ")
+		if err != nil {
+			return err
+		}
+	}
+	if password == "" {
+		return errors.New("empty password")
+	}
+	_, db, err := openDB()
+	if err != nil {
+		return err
+	}
+	plan, err := findPlan(db, planName)
+	if err != nil {
+		return err
+	}
+	user := &model.User{
+		Username: username,
+	}
+	sha512key := sha512.Sum512([]byte(password))
+	err = user.SetPassword(sha512key[:])
+	if err != nil {
+		return err
+	}
+	if admin {
+		user.Role = model.RoleAdmin
+	}
+	user.StartPlan(*plan, time.Now())
+	err = db.Omit("Plan").Create(user).Error
+	if err != nil {
+		return err
+	}
+	return printUsers(cmd, []model.User{*user})
+}
+
+func userListExec(cmd *cobra.Command, args []string) error {
+	_, db, err := openDB()
+	if err != nil {
+		return err
+	}
+	var users []model.User
+	err = db.Preload("Plan").Order("id").Find(&users).Error
+	if err != nil {
+		return err
+	}
+	return printUsers(cmd, users)
+}
+
+func userShowExec(cmd *cobra.Command, args []string) error {
+	_, db, err := openDB()
+	if err != nil {
+		return err
+	}
+	user, err := findUser(db, args[0])
+	if err != nil {
+		return err
+	}
+	return printUsers(cmd, []model.User{*user})
+}
+
+func userDeleteExec(cmd *cobra.Command, args []string) error {
+	_, db, err := openDB()
+	if err != nil {
+		return err
+	}
+	user, err := findUser(db, args[0])
+	if err != nil {
+		return err
+	}
+	err = db.Delete(&model.User{}, user.ID).Error
+	if err != nil {
+		return err
+	}
+	return printUsers(cmd, []model.User{*user})
+}
+
+func userSetPlanExec(cmd *cobra.Command, args []string) error {
+	_, db, err := openDB()
+	if err != nil {
+		return err
+	}
+	user, err := findUser(db, args[0])
+	if err != nil {
+		return err
+	}
+	plan, err := findPlan(db, args[1])
+	if err != nil {
+		return err
+	}
+	user.StartPlan(*plan, time.Now())
+	err = db.Model(user).Omit("Plan").Select("plan_id", "traffic_used", "plan_start", "plan_reset", "plan_end").Updates(user).Error
+	if err != nil {
+		return err
+	}
+	return printUsers(cmd, []model.User{*user})
+}
+
+func userResetTrafficExec(cmd *cobra.Command, args []string) error {
+	_, db, err := openDB()
+	if err != nil {
+		return err
+	}
+	user, err := findUser(db, args[0])
+	if err != nil {
+		return err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&model.TrafficReset{
+			UserID:      user.ID,
+			PlanID:      user.PlanID,
+			TrafficUsed: user.TrafficUsed,
+			Reason:      model.ResetReasonManual,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(user).Update("traffic_used", 0).Error
+	})
+	if err != nil {
+		return err
+	}
+	user.TrafficUsed = 0
+	return printUsers(cmd, []model.User{*user})
+}
@@ -0,0 +1,181 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	ErrNoHeader      = errors.New("proxyproto: no PROXY protocol header")
+	ErrInvalidHeader = errors.New("proxyproto: invalid PROXY protocol header")
+)
+
+const v1MaxLength = 107
+
+// Conn is a connection whose remote address is taken from the PROXY protocol header
+type Conn struct {
+	net.Conn
+	reader     *bufio.Reader
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+func NewConn(c net.Conn) *Conn {
+	return &Conn{
+		Conn:   c,
+		reader: bufio.NewReader(c),
+	}
+}
+
+// Read reads data from the connection after the PROXY protocol header.
+func (conn *Conn) Read(b []byte) (int, error) {
+	conn.once.Do(conn.readHeader)
+	if conn.err != nil {
+		return 0, conn.err
+	}
+	return conn.reader.Read(b)
+}
+
+// RemoteAddr returns the source address given in the PROXY protocol header,
+// or the address of the peer if the header does not carry one.
+func (conn *Conn) RemoteAddr() net.Addr {
+	conn.once.Do(conn.readHeader)
+	if conn.remoteAddr != nil {
+		return conn.remoteAddr
+	}
+	return conn.Conn.RemoteAddr()
+}
+
+func (conn *Conn) readHeader() {
+	sig, err := conn.reader.Peek(len(v1Prefix))
+	if err != nil {
+		conn.err = err
+		return
+	}
+	if bytes.Equal(sig, v1Prefix) {
+		conn.err = conn.readV1()
+		return
+	}
+	sig, err = conn.reader.Peek(len(v2Signature))
+	if err != nil {
+		conn.err = err
+		return
+	}
+	if bytes.Equal(sig, v2Signature) {
+		conn.err = conn.readV2()
+		return
+	}
+	conn.err = ErrNoHeader
+}
+
+/*
+PROXY TCP4 255.255.255.255 255.255.255.255 65535 65535\r\n
+PROXY TCP6 ffff:f...f:ffff ffff:f...f:ffff 65535 65535\r\n
+PROXY UNKNOWN\r\n
+*/
+func (conn *Conn) readV1() error {
+	var line []byte
+	for {
+		b, err := conn.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= v1MaxLength {
+			return ErrInvalidHeader
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return ErrInvalidHeader
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 {
+		return ErrInvalidHeader
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil
+	case "TCP4", "TCP6":
+		if len(fields) != 6 {
+			return ErrInvalidHeader
+		}
+		ip := net.ParseIP(fields[2])
+		port, err := strconv.ParseUint(fields[4], 10, 16)
+		if ip == nil || err != nil {
+			return ErrInvalidHeader
+		}
+		conn.remoteAddr = &net.TCPAddr{
+			IP:   ip,
+			Port: int(port),
+		}
+		return nil
+	default:
+		return ErrInvalidHeader
+	}
+}
+
+/*
++----------------+----------+--------+--------+-----------+
+|   signature    | ver_cmd  |  fam   |  len   | addresses |
++----------------+----------+--------+--------+-----------+
+|       12       |    1     |   1    |   2    |  len      |
++----------------+----------+--------+--------+-----------+
+*/
+func (conn *Conn) readV2() error {
+	header := make([]byte, len(v2Signature)+4)
+	_, err := io.ReadFull(conn.reader, header)
+	if err != nil {
+		return err
+	}
+	verCmd := header[12]
+	fam := header[13]
+	length := binary.BigEndian.Uint16(header[14:16])
+	if verCmd>>4 != 0x2 {
+		return ErrInvalidHeader
+	}
+	addresses := make([]byte, length)
+	_, err = io.ReadFull(conn.reader, addresses)
+	if err != nil {
+		return err
+	}
+	//LOCAL command, the connection was established by the proxy itself
+	if verCmd&0x0F == 0x0 {
+		return nil
+	}
+	if verCmd&0x0F != 0x1 {
+		return ErrInvalidHeader
+	}
+	switch fam >> 4 {
+	case 0x1: //AF_INET
+		if len(addresses) < 12 {
+			return ErrInvalidHeader
+		}
+		conn.remoteAddr = &net.TCPAddr{
+			IP:   net.IP(addresses[0:4]).To16(),
+			Port: int(binary.BigEndian.Uint16(addresses[8:10])),
+		}
+	case 0x2: //AF_INET6
+		if len(addresses) < 36 {
+			return ErrInvalidHeader
+		}
+		conn.remoteAddr = &net.TCPAddr{
+			IP:   net.IP(addresses[0:16]),
+			Port: int(binary.BigEndian.Uint16(addresses[32:34])),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package proxyproto
+
+import "net"
+
+type Listener struct {
+	net.Listener
+}
+
+func NewListener(ln net.Listener) *Listener {
+	return &Listener{Listener: ln}
+}
+
+// Accept waits for and returns the next connection to the listener.
+// The PROXY protocol header is read lazily on the first Read or RemoteAddr call,
+// so that a slow client does not block the accept loop.
+func (listener *Listener) Accept() (net.Conn, error) {
+	c, err := listener.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(c), nil
+}
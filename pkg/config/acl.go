@@ -0,0 +1,132 @@
+package config
+
+import (
+	"net"
+	"strings"
+
+	"github.com/iyouport-org/relaybaton/pkg/util"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ACLActionAllow = "allow"
+	ACLActionDeny  = "deny"
+)
+
+// DestinationTOML describes a set of destinations.
+// A destination matches when every non-empty condition matches, any entry of a condition is enough.
+type DestinationTOML struct {
+	Ports     []string `mapstructure:"ports" toml:"ports" json:"ports" validate:"omitempty"`
+	CIDRs     []string `mapstructure:"cidrs" toml:"cidrs" json:"cidrs" validate:"omitempty,dive,cidr"`
+	Domains   []string `mapstructure:"domains" toml:"domains" json:"domains" validate:"omitempty,dive,required"`
+	Countries []string `mapstructure:"countries" toml:"countries" json:"countries" validate:"omitempty,dive,iso3166_1_alpha2"`
+}
+
+type Destination struct {
+	Ports     []util.PortRange
+	CIDRs     []*net.IPNet
+	Domains   []string
+	Countries []string
+}
+
+// ACLRuleTOML is a rule of the destination access control list
+type ACLRuleTOML struct {
+	Action          string `mapstructure:"action" toml:"action" json:"action" validate:"required,oneof=allow deny"`
+	DestinationTOML `mapstructure:",squash"`
+}
+
+type ACLRule struct {
+	Allow bool
+	*Destination
+}
+
+func (art *ACLRuleTOML) Init() (rule *ACLRule, err error) {
+	rule = &ACLRule{
+		Allow: art.Action == ACLActionAllow,
+	}
+	rule.Destination, err = art.DestinationTOML.Init("server.acl")
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (dt *DestinationTOML) Init(key string) (dest *Destination, err error) {
+	dest = &Destination{}
+	for _, s := range dt.Ports {
+		pr, err := util.ParsePortRange(s)
+		if err != nil {
+			log.WithField(key+".ports", s).Error(err)
+			return nil, err
+		}
+		dest.Ports = append(dest.Ports, pr)
+	}
+	for _, cidr := range dt.CIDRs {
+		_, block, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.WithField(key+".cidrs", cidr).Error(err)
+			return nil, err
+		}
+		dest.CIDRs = append(dest.CIDRs, block)
+	}
+	for _, domain := range dt.Domains {
+		dest.Domains = append(dest.Domains, strings.ToLower(strings.Trim(domain, ".")))
+	}
+	for _, country := range dt.Countries {
+		dest.Countries = append(dest.Countries, strings.ToUpper(country))
+	}
+	return dest, nil
+}
+
+// MatchPort reports whether port is matched by the destination
+func (dest *Destination) MatchPort(port uint16) bool {
+	if len(dest.Ports) == 0 {
+		return true
+	}
+	for _, pr := range dest.Ports {
+		if pr.Contains(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchIP reports whether ip is matched by the destination
+func (dest *Destination) MatchIP(ip net.IP) bool {
+	if len(dest.CIDRs) == 0 {
+		return true
+	}
+	for _, block := range dest.CIDRs {
+		if block.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchDomain reports whether host is one of the domains of the destination or their subdomains
+func (dest *Destination) MatchDomain(host string) bool {
+	if len(dest.Domains) == 0 {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range dest.Domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchCountry reports whether the ISO country code is matched by the destination
+func (dest *Destination) MatchCountry(country string) bool {
+	if len(dest.Countries) == 0 {
+		return true
+	}
+	for _, c := range dest.Countries {
+		if c == country {
+			return true
+		}
+	}
+	return false
+}
@@ -1,33 +1,57 @@
 package config
 
+const (
+	DefaultServerPort = 443
+	DefaultServerPath = "/"
+)
+
 type ClientTOML struct {
-	Port      int    `mapstructure:"port" toml:"port" validate:"numeric,gte=0,lte=65535,required,nefield=HTTPPort"`
-	HTTPPort  int    `mapstructure:"http_port" toml:"http_port" validate:"numeric,gte=0,lte=65535,required,nefield=RedirPort"`
-	RedirPort int    `mapstructure:"redir_port" toml:"redir_port" validate:"numeric,gte=0,lte=65535,required,nefield=Port"`
-	Server    string `mapstructure:"server"  toml:"server" validate:"hostname,required"`
-	Username  string `mapstructure:"username" toml:"username" validate:"required"`
-	Password  string `mapstructure:"password" toml:"password" validate:"required"`
-	ProxyAll  bool   `mapstructure:"proxy_all" toml:"proxy_all"`
+	Port         int    `mapstructure:"port" toml:"port" validate:"numeric,gte=0,lte=65535,required,nefield=HTTPPort"`
+	HTTPPort     int    `mapstructure:"http_port" toml:"http_port" validate:"numeric,gte=0,lte=65535,required,nefield=RedirPort"`
+	RedirPort    int    `mapstructure:"redir_port" toml:"redir_port" validate:"numeric,gte=0,lte=65535,required,nefield=Port"`
+	Server       string `mapstructure:"server"  toml:"server" validate:"hostname,required"`
+	ServerPort   int    `mapstructure:"server_port" toml:"server_port" validate:"numeric,gte=0,lte=65535"`
+	ServerPath   string `mapstructure:"server_path" toml:"server_path" validate:"omitempty,startswith=/"`
+	Username     string `mapstructure:"username" toml:"username" validate:"required"`
+	Password     string `mapstructure:"password" toml:"password" validate:"required"`
+	ProxyAll     bool   `mapstructure:"proxy_all" toml:"proxy_all"`
+	ControlPort  int    `mapstructure:"control_port" toml:"control_port" validate:"numeric,gte=0,lte=65535"`
+	ControlToken string `mapstructure:"control_token" toml:"control_token"`
 }
 
 type ClientGo struct {
-	Port      uint16
-	HTTPPort  uint16
-	RedirPort uint16
-	Server    string
-	Username  string
-	Password  string
-	ProxyAll  bool
+	Port         uint16
+	HTTPPort     uint16
+	RedirPort    uint16
+	Server       string
+	ServerPort   uint16
+	ServerPath   string
+	Username     string
+	Password     string
+	ProxyAll     bool
+	ControlPort  uint16 //port of the local control API on the loopback interface, 0 for disabled
+	ControlToken string
 }
 
 func (ct *ClientTOML) Init() (cg *ClientGo, err error) {
-	return &ClientGo{
-		Port:      uint16(ct.Port),
-		HTTPPort:  uint16(ct.HTTPPort),
-		RedirPort: uint16(ct.RedirPort),
-		Server:    ct.Server,
-		Username:  ct.Username,
-		Password:  ct.Password,
-		ProxyAll:  ct.ProxyAll,
-	}, nil
+	cg = &ClientGo{
+		Port:         uint16(ct.Port),
+		HTTPPort:     uint16(ct.HTTPPort),
+		RedirPort:    uint16(ct.RedirPort),
+		Server:       ct.Server,
+		ServerPort:   uint16(ct.ServerPort),
+		ServerPath:   ct.ServerPath,
+		Username:     ct.Username,
+		Password:     ct.Password,
+		ProxyAll:     ct.ProxyAll,
+		ControlPort:  uint16(ct.ControlPort),
+		ControlToken: ct.ControlToken,
+	}
+	if cg.ServerPort == 0 {
+		cg.ServerPort = DefaultServerPort
+	}
+	if cg.ServerPath == "" {
+		cg.ServerPath = DefaultServerPath
+	}
+	return cg, nil
 }
@@ -1,32 +1,55 @@
 package config
 
 import (
+	"io/ioutil"
 	"net"
+	"sync"
+	"sync/atomic"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/iyouport-org/relaybaton/pkg/dns"
 	"github.com/iyouport-org/relaybaton/pkg/log"
-	"github.com/iyouport-org/relaybaton/pkg/model"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
 // ConfigTOML is the struct mapped from the configuration file
 type ConfigTOML struct {
-	Log    *LogTOML    `mapstructure:"log" toml:"log" validate:"required"`
-	DNS    *DNSToml    `mapstructure:"dns" toml:"dns" validate:"required"`
-	Client *ClientTOML `mapstructure:"client" toml:"client" validate:"-"`
-	Server *ServerTOML `mapstructure:"server" toml:"server" validate:"-"`
-	DB     *DBToml     `mapstructure:"db" toml:"db" validate:"-"`
+	Log    *LogTOML    `mapstructure:"log" toml:"log" json:"log" validate:"required"`
+	DNS    *DNSToml    `mapstructure:"dns" toml:"dns" json:"dns" validate:"required"`
+	Client *ClientTOML `mapstructure:"client" toml:"client" json:"-" validate:"-"`
+	Server *ServerTOML `mapstructure:"server" toml:"server" json:"server" validate:"-"`
+	DB     *DBToml     `mapstructure:"db" toml:"db" json:"db" validate:"-"`
 }
 
 type ConfigGo struct {
-	toml   *ConfigTOML
-	Log    *LogGo    //client,server
-	DNS    *DNSGo    //client,server
-	Client *ClientGo //client
-	Server *serverGo //server
-	DB     *dbGo     //server
+	mutex     sync.Mutex //serializes reloads
+	toml      *ConfigTOML
+	effective *ConfigTOML       //toml overridden by settings
+	settings  map[string]string //runtime settings from the database, JSON values by key
+	Log       *LogGo            //client,server
+	dns       atomic.Value      //*DNSGo, client,server
+	client    atomic.Value      //*ClientGo, client
+	server    atomic.Value      //*serverGo, server
+	DB        *dbGo             //server
+}
+
+// DNS returns the DNS settings, a reload publishes new settings instead of modifying these
+func (conf *ConfigGo) DNS() *DNSGo {
+	dnsGo, _ := conf.dns.Load().(*DNSGo)
+	return dnsGo
+}
+
+// Client returns the client settings, nil on the server. A reload publishes new settings instead of modifying these
+func (conf *ConfigGo) Client() *ClientGo {
+	clientGo, _ := conf.client.Load().(*ClientGo)
+	return clientGo
+}
+
+// Server returns the server settings, nil on the client. A reload publishes new settings instead of modifying these
+func (conf *ConfigGo) Server() *serverGo {
+	sg, _ := conf.server.Load().(*serverGo)
+	return sg
 }
 
 func (mc *ConfigTOML) Init() (cg *ConfigGo, err error) {
@@ -37,16 +60,18 @@ func (mc *ConfigTOML) Init() (cg *ConfigGo, err error) {
 	}
 	cg = &ConfigGo{}
 	cg.toml = mc
+	cg.effective = mc
 	cg.Log, err = mc.Log.Init()
 	if err != nil {
 		logrus.Error(err)
 		return nil, err
 	}
-	cg.DNS, err = mc.DNS.Init()
+	dnsGo, err := mc.DNS.Init()
 	if err != nil {
 		logrus.Error(err)
 		return nil, err
 	}
+	cg.dns.Store(dnsGo)
 	return cg, nil
 }
 
@@ -56,9 +81,13 @@ func (conf *ConfigGo) SaveClient(filename string) error {
 	v.Set("client.http_port", conf.toml.Client.HTTPPort)
 	v.Set("client.redir_port", conf.toml.Client.RedirPort)
 	v.Set("client.server", conf.toml.Client.Server)
+	v.Set("client.server_port", conf.toml.Client.ServerPort)
+	v.Set("client.server_path", conf.toml.Client.ServerPath)
 	v.Set("client.username", conf.toml.Client.Username)
 	v.Set("client.password", conf.toml.Client.Password)
 	v.Set("client.proxy_all", conf.toml.Client.ProxyAll)
+	v.Set("client.control_port", conf.toml.Client.ControlPort)
+	v.Set("client.control_token", conf.toml.Client.ControlToken)
 	v.Set("dns.type", conf.toml.DNS.Type)
 	v.Set("dns.server", conf.toml.DNS.Server)
 	v.Set("dns.addr", conf.toml.DNS.Addr)
@@ -98,11 +127,12 @@ func (conf *ConfigGo) InitClient() error {
 		logrus.Error(err)
 		return err
 	}
-	conf.Client, err = conf.toml.Client.Init()
+	clientGo, err := conf.toml.Client.Init()
 	if err != nil {
 		logrus.Error(err)
 		return err
 	}
+	conf.client.Store(clientGo)
 	return nil
 }
 
@@ -119,11 +149,12 @@ func NewConfServer() (conf *ConfigGo, err error) {
 	if err != nil {
 		return nil, err
 	}
-	conf.Server, err = conf.toml.Server.Init()
+	sg, err := conf.toml.Server.Init()
 	if err != nil {
 		logrus.Error(err)
 		return nil, err
 	}
+	conf.server.Store(sg)
 	err = validate.Struct(conf.toml.DB)
 	if err != nil {
 		return nil, err
@@ -136,24 +167,46 @@ func NewConfServer() (conf *ConfigGo, err error) {
 	return conf, nil
 }
 
+// NewConfDB loads the configuration and connects to the database without migrating it
+func NewConfDB() (conf *ConfigGo, err error) {
+	conf = NewConf()
+	validate := validator.New()
+	err = validate.Struct(conf.toml.DB)
+	if err != nil {
+		return nil, err
+	}
+	conf.DB, err = conf.toml.DB.Open()
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+	return conf, nil
+}
+
+// InitLog writes the log to the sinks of log, and to the database at log.level on the server
 func InitLog(conf *ConfigGo) {
 	logrus.SetFormatter(log.XMLFormatter{})
-	logrus.SetOutput(conf.Log.File)
-	logrus.SetLevel(conf.Log.Level)
+	logrus.SetOutput(ioutil.Discard)
 	if conf.DB != nil {
-		conf.DB.DB.AutoMigrate(&model.Log{})
-		logrus.AddHook(log.NewSQLiteHook(conf.DB.DB))
+		conf.Log.Sinks = append(conf.Log.Sinks, &LogSinkGo{
+			LevelHook: log.NewLevelHook(log.NewSQLiteHook(conf.DB.DB), conf.Log.Level),
+			Follow:    true,
+		})
 	}
-
+	for _, sink := range conf.Log.Sinks {
+		logrus.AddHook(sink)
+	}
+	conf.Log.SetLevel(conf.Log.Level)
 }
 
 func InitDNS(conf *ConfigGo) {
-	switch conf.DNS.Type {
+	dnsGo := conf.DNS()
+	switch dnsGo.Type {
 	case DNSTypeDoT:
-		factory := dns.NewDoTResolverFactory(net.Dialer{}, conf.DNS.Server, conf.DNS.Addr, false)
+		factory := dns.NewDoTResolverFactory(net.Dialer{}, dnsGo.Server, dnsGo.Addr, false)
 		net.DefaultResolver = factory.GetResolver()
 	case DNSTypeDoH:
-		factory, err := dns.NewDoHResolverFactory(net.Dialer{}, 1083, conf.DNS.Server, conf.DNS.Addr, false)
+		factory, err := dns.NewDoHResolverFactory(net.Dialer{}, 1083, dnsGo.Server, dnsGo.Addr, false)
 		if err != nil {
 			logrus.Error(err)
 			return
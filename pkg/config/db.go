@@ -4,7 +4,7 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/iyouport-org/relaybaton/pkg/model"
+	"github.com/iyouport-org/relaybaton/pkg/migration"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/driver/mysql"     //mysql
 	"gorm.io/driver/postgres"  //postgres
@@ -23,12 +23,12 @@ const (
 )
 
 type DBToml struct {
-	Type     string `mapstructure:"type"  toml:"type" validate:"required"`
-	Username string `mapstructure:"username"  toml:"username" validate:"required"`
-	Password string `mapstructure:"password"  toml:"password" validate:"required"`
-	Host     string `mapstructure:"host"  toml:"host" validate:"required"`
-	Port     int    `mapstructure:"port"  toml:"port" validate:"required"`
-	Database string `mapstructure:"database"  toml:"database" validate:"required"`
+	Type     string `mapstructure:"type"  toml:"type" json:"type" validate:"required"`
+	Username string `mapstructure:"username"  toml:"username" json:"username" validate:"required"`
+	Password string `mapstructure:"password"  toml:"password" json:"password" validate:"required"`
+	Host     string `mapstructure:"host"  toml:"host" json:"host" validate:"required"`
+	Port     int    `mapstructure:"port"  toml:"port" json:"port" validate:"required"`
+	Database string `mapstructure:"database"  toml:"database" json:"database" validate:"required"`
 }
 
 type dbGo struct {
@@ -36,7 +36,8 @@ type dbGo struct {
 	DB   *gorm.DB
 }
 
-func (dbt *DBToml) Init() (dbg *dbGo, err error) {
+// Open connects to the database without migrating it
+func (dbt *DBToml) Open() (dbg *dbGo, err error) {
 	dbg = &dbGo{}
 	conf := &gorm.Config{
 		//Logger: &relaybaton_log.DBLogger{Logger: log.New()},
@@ -79,31 +80,20 @@ func (dbt *DBToml) Init() (dbg *dbGo, err error) {
 		}).Error(err)
 		return nil, err
 	}
+	return dbg, nil
+}
 
-	err = dbg.DB.AutoMigrate(&model.User{})
-	if err != nil {
-		log.Error(err)
-		return nil, err
-	}
-	err = dbg.DB.AutoMigrate(&model.Log{})
-	if err != nil {
-		log.Error(err)
-		return nil, err
-	}
-	err = dbg.DB.AutoMigrate(&model.Meta{})
-	if err != nil {
-		log.Error(err)
-		return nil, err
-	}
-	err = dbg.DB.AutoMigrate(&model.Notice{})
+// Init connects to the database and applies the pending migrations,
+// it refuses a database migrated by a newer version
+func (dbt *DBToml) Init() (dbg *dbGo, err error) {
+	dbg, err = dbt.Open()
 	if err != nil {
-		log.Error(err)
 		return nil, err
 	}
-	err = dbg.DB.AutoMigrate(&model.Plan{})
+	_, err = migration.Migrate(dbg.DB)
 	if err != nil {
-		log.Error(err)
+		log.WithField("schema", migration.Latest()).Error(err)
 		return nil, err
 	}
-	return dbg, err
+	return dbg, nil
 }
@@ -17,9 +17,9 @@ const (
 )
 
 type DNSToml struct {
-	Type   string `mapstructure:"type" toml:"type" validate:"oneof='default' 'dot' 'doh',required"`
-	Server string `mapstructure:"server" toml:"server" validate:"omitempty,required,hostname|hostname_rfc1123|fqdn,required"`
-	Addr   string `mapstructure:"addr" toml:"addr" validate:"omitempty,required,ip|ip_addr|tcp_addr|udp_addr,required"`
+	Type   string `mapstructure:"type" toml:"type" json:"type" validate:"oneof='default' 'dot' 'doh',required"`
+	Server string `mapstructure:"server" toml:"server" json:"server" validate:"omitempty,required,hostname|hostname_rfc1123|fqdn,required"`
+	Addr   string `mapstructure:"addr" toml:"addr" json:"addr" validate:"omitempty,required,ip|ip_addr|tcp_addr|udp_addr,required"`
 }
 
 type DNSGo struct {
@@ -3,44 +3,182 @@ package config
 import (
 	"errors"
 	"os"
+	"time"
 
+	rblog "github.com/iyouport-org/relaybaton/pkg/log"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	LogSinkFile   = "file"
+	LogSinkStderr = "stderr"
+	LogSinkSyslog = "syslog"
+)
+
+const DefaultSyslogTag = "relaybaton"
+
 type LogTOML struct {
-	File  string `mapstructure:"file" toml:"file"  validate:"required"`
-	Level string `mapstructure:"level" toml:"level"  validate:"required,oneof=panic fatal error warn info debug trace "`
+	File          string                   `mapstructure:"file" toml:"file" json:"file" validate:"required_without=Sinks"`
+	Level         string                   `mapstructure:"level" toml:"level" json:"level" validate:"required,oneof=panic fatal error warn info debug trace "`
+	Format        string                   `mapstructure:"format" toml:"format" json:"format" validate:"omitempty,oneof=xml json text"`
+	Sinks         []*LogSinkTOML           `mapstructure:"sinks" toml:"sinks" json:"sinks" validate:"omitempty,dive"`
+	LogRotateTOML `mapstructure:",squash"` //rotation of file
+}
+
+// LogRotateTOML rotates a log file by size or time, the file is never rotated if both are unset
+type LogRotateTOML struct {
+	MaxSize    int    `mapstructure:"max_size" toml:"max_size" json:"max_size" validate:"numeric,gte=0"`
+	Rotate     string `mapstructure:"rotate" toml:"rotate" json:"rotate" validate:"omitempty,oneof=hourly daily"`
+	MaxBackups int    `mapstructure:"max_backups" toml:"max_backups" json:"max_backups" validate:"numeric,gte=0"`
+	MaxAge     int    `mapstructure:"max_age" toml:"max_age" json:"max_age" validate:"numeric,gte=0"`
+	Compress   bool   `mapstructure:"compress" toml:"compress" json:"compress"`
+}
+
+// LogSinkTOML is an additional log output, its level and format default to those of log
+type LogSinkTOML struct {
+	Type          string `mapstructure:"type" toml:"type" json:"type" validate:"required,oneof=file stderr syslog"`
+	Level         string `mapstructure:"level" toml:"level" json:"level" validate:"omitempty,oneof=panic fatal error warn info debug trace"`
+	Format        string `mapstructure:"format" toml:"format" json:"format" validate:"omitempty,oneof=xml json text"`
+	File          string `mapstructure:"file" toml:"file" json:"file" validate:"required_if=Type file"`
+	LogRotateTOML `mapstructure:",squash"`
+	Addr          string `mapstructure:"addr" toml:"addr" json:"addr"` //syslog socket, the local syslog if empty
+	Tag           string `mapstructure:"tag" toml:"tag" json:"tag"`
 }
 
 type LogGo struct {
-	File  *os.File
 	Level log.Level
+	Sinks []*LogSinkGo
+}
+
+type LogSinkGo struct {
+	*rblog.LevelHook
+	Follow bool //the level of the sink is log.level
 }
 
 func (lt *LogTOML) Init() (lg *LogGo, err error) {
 	lg = &LogGo{}
-	fi, err := os.Stat(lt.File)
+	lg.Level, err = log.ParseLevel(lt.Level)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			log.WithField("log.file", lt.File).Error(err)
+		log.WithField("log.level", lt.Level).Error(err)
+		return nil, err
+	}
+	if lt.File != "" {
+		sink, err := (&LogSinkTOML{
+			Type:          LogSinkFile,
+			File:          lt.File,
+			LogRotateTOML: lt.LogRotateTOML,
+		}).Init(lt)
+		if err != nil {
 			return nil, err
 		}
-	} else {
-		if fi.IsDir() {
-			err = errors.New("is directory")
-			log.WithField("log.file", lt.File).Error(err)
+		lg.Sinks = append(lg.Sinks, sink)
+	}
+	for _, st := range lt.Sinks {
+		sink, err := st.Init(lt)
+		if err != nil {
+			lg.Close()
 			return nil, err
 		}
+		lg.Sinks = append(lg.Sinks, sink)
+	}
+	return lg, nil
+}
+
+func (st *LogSinkTOML) Init(lt *LogTOML) (sink *LogSinkGo, err error) {
+	format := st.Format
+	if format == "" {
+		format = lt.Format
 	}
-	lg.File, err = os.OpenFile(lt.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0755)
+	formatter, err := rblog.NewFormatter(format)
 	if err != nil {
-		log.WithField("log.file", lt.File).Error(err)
+		log.WithField("log.format", format).Error(err)
 		return nil, err
 	}
-	lg.Level, err = log.ParseLevel(lt.Level)
+	level := st.Level
+	if level == "" {
+		level = lt.Level
+	}
+	lvl, err := log.ParseLevel(level)
 	if err != nil {
-		log.WithField("log.level", lt.Level).Error()
+		log.WithField("log.level", level).Error(err)
 		return nil, err
 	}
-	return lg, nil
+	var hook *rblog.WriterHook
+	switch st.Type {
+	case LogSinkFile:
+		fi, err := os.Stat(st.File)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.WithField("log.file", st.File).Error(err)
+				return nil, err
+			}
+		} else if fi.IsDir() {
+			err = errors.New("is directory")
+			log.WithField("log.file", st.File).Error(err)
+			return nil, err
+		}
+		if st.MaxSize == 0 && st.Rotate == "" {
+			file, err := os.OpenFile(st.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0755)
+			if err != nil {
+				log.WithField("log.file", st.File).Error(err)
+				return nil, err
+			}
+			hook = rblog.NewWriterHook(file, formatter)
+		} else {
+			var interval time.Duration
+			switch st.Rotate {
+			case "hourly":
+				interval = time.Hour
+			case "daily":
+				interval = 24 * time.Hour
+			}
+			hook = rblog.NewWriterHook(rblog.NewRotatingFile(st.File, st.MaxSize, st.MaxBackups, st.MaxAge, st.Compress, interval), formatter)
+		}
+	case LogSinkStderr:
+		hook = rblog.NewWriterHook(os.Stderr, formatter)
+	case LogSinkSyslog:
+		tag := st.Tag
+		if tag == "" {
+			tag = DefaultSyslogTag
+		}
+		w, err := rblog.NewSyslog(st.Addr, tag)
+		if err != nil {
+			log.WithField("log.sinks.addr", st.Addr).Error(err)
+			return nil, err
+		}
+		hook = rblog.NewWriterHook(w, formatter)
+	default:
+		err = errors.New("unknown log sink: " + st.Type)
+		log.WithField("log.sinks.type", st.Type).Error(err)
+		return nil, err
+	}
+	return &LogSinkGo{
+		LevelHook: rblog.NewLevelHook(hook, lvl),
+		Follow:    st.Level == "",
+	}, nil
+}
+
+// SetLevel changes log.level, the sinks without their own level follow it
+func (lg *LogGo) SetLevel(level log.Level) {
+	lg.Level = level
+	max := level
+	for _, sink := range lg.Sinks {
+		if sink.Follow {
+			sink.SetLevel(level)
+		}
+		if sink.Level() > max {
+			max = sink.Level()
+		}
+	}
+	log.SetLevel(max)
+}
+
+// Close closes the outputs of the sinks
+func (lg *LogGo) Close() {
+	for _, sink := range lg.Sinks {
+		err := sink.Close()
+		if err != nil {
+			log.Error(err)
+		}
+	}
 }
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Watch reloads the configuration when the file changes or on SIGHUP, then calls apply
+// so that the owner of the configuration can pick up the changes
+func (conf *ConfigGo) Watch(apply func()) {
+	reload := func() {
+		restart, err := conf.Reload()
+		if err != nil {
+			logrus.WithField("file", viper.ConfigFileUsed()).Error(err)
+			return
+		}
+		for _, key := range restart {
+			logrus.WithField("key", key).Warn("configuration changed, restart to apply")
+		}
+		if apply != nil {
+			apply()
+		}
+		logrus.WithField("file", viper.ConfigFileUsed()).Info("configuration reloaded")
+	}
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		reload()
+	})
+	viper.WatchConfig()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		for range sig {
+			reload()
+		}
+	}()
+}
+
+// Reload reads the configuration file again. The new configuration is validated as a whole before
+// anything is applied, then the settings which can change at runtime are replaced and the keys of
+// the changed settings which need a restart are returned, these keep their current values.
+// The new DNS, Client and Server settings are published as a whole, never modified in place.
+func (conf *ConfigGo) Reload() (restart []string, err error) {
+	conf.mutex.Lock()
+	defer conf.mutex.Unlock()
+	v := viper.GetViper()
+	err = v.ReadInConfig()
+	if err != nil {
+		return nil, err
+	}
+	var mc ConfigTOML
+	err = v.Unmarshal(&mc)
+	if err != nil {
+		return nil, err
+	}
+	return conf.apply(&mc, conf.settings)
+}
+
+// prepared is a validated configuration which has not been applied yet
+type prepared struct {
+	mc       *ConfigTOML
+	ec       *ConfigTOML
+	settings map[string]string
+	level    logrus.Level
+	dnsGo    *DNSGo
+	clientGo *ClientGo
+	sg       *serverGo
+}
+
+// prepare validates the configuration mc overridden by settings, nothing is applied
+func (conf *ConfigGo) prepare(mc *ConfigTOML, settings map[string]string) (p *prepared, err error) {
+	validate := validator.New()
+	err = validate.Struct(mc)
+	if err != nil {
+		return nil, err
+	}
+	p = &prepared{
+		mc:       mc,
+		settings: settings,
+	}
+	p.ec, err = overlay(mc, settings)
+	if err != nil {
+		return nil, err
+	}
+	err = validate.Struct(p.ec)
+	if err != nil {
+		return nil, err
+	}
+	p.level, err = logrus.ParseLevel(p.ec.Log.Level)
+	if err != nil {
+		return nil, err
+	}
+	p.dnsGo, err = p.ec.DNS.Init()
+	if err != nil {
+		return nil, err
+	}
+	if conf.Client() != nil {
+		err = validate.Struct(p.ec.Client)
+		if err != nil {
+			return nil, err
+		}
+		p.clientGo, err = p.ec.Client.Init()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conf.Server() != nil {
+		err = validate.Struct(p.ec.Server)
+		if err != nil {
+			return nil, err
+		}
+		p.sg, err = p.ec.Server.Init()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// apply validates the configuration mc overridden by settings and applies it, like Reload
+func (conf *ConfigGo) apply(mc *ConfigTOML, settings map[string]string) (restart []string, err error) {
+	p, err := conf.prepare(mc, settings)
+	if err != nil {
+		return nil, err
+	}
+	mc, ec := p.mc, p.ec
+	if lt, changed := keepLog(conf.toml.Log, mc.Log); changed {
+		restart = append(restart, "log")
+		mc.Log = lt
+		ec.Log, _ = keepLog(conf.toml.Log, ec.Log)
+	}
+	conf.Log.SetLevel(p.level)
+	conf.dns.Store(p.dnsGo)
+	InitDNS(conf)
+	if conf.DB != nil && !reflect.DeepEqual(mc.DB, conf.toml.DB) {
+		restart = append(restart, "db")
+		mc.DB = conf.toml.DB
+		ec.DB = conf.toml.DB
+	}
+	if p.clientGo != nil {
+		restart = append(restart, keepClient(conf.Client(), p.clientGo)...)
+		conf.client.Store(p.clientGo)
+	}
+	if p.sg != nil {
+		restart = append(restart, keepServer(conf.Server(), p.sg)...)
+		conf.server.Store(p.sg)
+	}
+	conf.toml = mc
+	conf.effective = ec
+	conf.settings = settings
+	return restart, nil
+}
+
+// keepLog returns the outputs of current with the level of next, changed reports whether the outputs differ
+func keepLog(current *LogTOML, next *LogTOML) (lt *LogTOML, changed bool) {
+	kept := *current
+	kept.Level = next.Level
+	return &kept, !reflect.DeepEqual(&kept, next)
+}
+
+// keepClient restores the listeners of the client in next, it returns the keys which differ
+func keepClient(current *ClientGo, next *ClientGo) (restart []string) {
+	if next.Port != current.Port {
+		restart = append(restart, "client.port")
+		next.Port = current.Port
+	}
+	if next.HTTPPort != current.HTTPPort {
+		restart = append(restart, "client.http_port")
+		next.HTTPPort = current.HTTPPort
+	}
+	if next.RedirPort != current.RedirPort {
+		restart = append(restart, "client.redir_port")
+		next.RedirPort = current.RedirPort
+	}
+	if next.ControlPort != current.ControlPort {
+		restart = append(restart, "client.control_port")
+		next.ControlPort = current.ControlPort
+	}
+	return restart
+}
+
+// keepServer restores the listeners, routes and background tasks of the server in next, it returns the keys which differ
+func keepServer(current *serverGo, next *serverGo) (restart []string) {
+	if next.Port != current.Port {
+		restart = append(restart, "server.port")
+		next.Port = current.Port
+	}
+	if next.AdminPath != current.AdminPath {
+		restart = append(restart, "server.admin_path")
+		next.AdminPath = current.AdminPath
+	}
+	if next.AdminNetwork != current.AdminNetwork || next.AdminAddr != current.AdminAddr {
+		restart = append(restart, "server.admin_addr")
+		next.AdminNetwork = current.AdminNetwork
+		next.AdminAddr = current.AdminAddr
+	}
+	if !reflect.DeepEqual(next.Pretend, current.Pretend) || next.PretendDir != current.PretendDir {
+		restart = append(restart, "server.pretend")
+		next.Pretend = current.Pretend
+		next.PretendDir = current.PretendDir
+	}
+	if next.ProxyProtocol != current.ProxyProtocol {
+		restart = append(restart, "server.proxy_protocol")
+		next.ProxyProtocol = current.ProxyProtocol
+	}
+	if next.TrafficFlushInterval != current.TrafficFlushInterval {
+		restart = append(restart, "server.traffic_flush_interval")
+		next.TrafficFlushInterval = current.TrafficFlushInterval
+	}
+	if next.ScheduleInterval != current.ScheduleInterval {
+		restart = append(restart, "server.schedule_interval")
+		next.ScheduleInterval = current.ScheduleInterval
+	}
+	if next.NodeName != current.NodeName {
+		restart = append(restart, "server.node_name")
+		next.NodeName = current.NodeName
+	}
+	if next.HeartbeatInterval != current.HeartbeatInterval {
+		restart = append(restart, "server.heartbeat_interval")
+		next.HeartbeatInterval = current.HeartbeatInterval
+	}
+	if !reflect.DeepEqual(next.SessionKeys, current.SessionKeys) {
+		restart = append(restart, "server.session_keys")
+		next.SessionKeys = current.SessionKeys
+	}
+	if next.SessionStore != current.SessionStore {
+		restart = append(restart, "server.session_store")
+		next.SessionStore = current.SessionStore
+	}
+	if !reflect.DeepEqual(next.TLS, current.TLS) {
+		restart = append(restart, "server.tls")
+		next.TLS = current.TLS
+	}
+	return restart
+}
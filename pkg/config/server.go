@@ -1,21 +1,250 @@
 package config
 
+import (
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
 const DEFAULT_ADMIN_USERNAME = "admin"
 
+const (
+	DefaultAdminPath            = "/"
+	DefaultTrafficFlushInterval = 30 * time.Second
+	DefaultScheduleInterval     = time.Minute
+	DefaultConnectionRetention  = 30 * 24 * time.Hour
+	DefaultLogRetention         = 30 * 24 * time.Hour
+	DefaultHeartbeatInterval    = 10 * time.Second
+	DefaultSessionIdleTimeout   = 2 * time.Hour
+	DefaultSessionLifetime      = 7 * 24 * time.Hour
+	DefaultPlanID               = 1
+)
+
+const (
+	SessionStoreCookie = "cookie"
+	SessionStoreDB     = "db"
+)
+
+const (
+	RegistrationOpen   = "open"
+	RegistrationClosed = "closed"
+)
+
 type ServerTOML struct {
-	Port          int    `mapstructure:"port" toml:"port" validate:"numeric,gte=0,lte=65535,required"`
-	AdminPassword string `mapstructure:"admin_password" toml:"pretend" validate:"required"`
+	Port                 int                         `mapstructure:"port" toml:"port" json:"port" validate:"numeric,gte=0,lte=65535,required"`
+	AdminPassword        string                      `mapstructure:"admin_password" toml:"admin_password" json:"admin_password" validate:"required"`
+	AdminPath            string                      `mapstructure:"admin_path" toml:"admin_path" json:"admin_path" validate:"omitempty,startswith=/"`
+	AdminAddr            string                      `mapstructure:"admin_addr" toml:"admin_addr" json:"admin_addr" validate:"omitempty,tcp_addr|startswith=unix:"`
+	AdminAllow           []string                    `mapstructure:"admin_allow" toml:"admin_allow" json:"admin_allow" validate:"omitempty,dive,cidr"`
+	Pretend              string                      `mapstructure:"pretend" toml:"pretend" json:"pretend" validate:"omitempty,url,excluded_with=PretendDir"`
+	PretendDir           string                      `mapstructure:"pretend_dir" toml:"pretend_dir" json:"pretend_dir" validate:"omitempty,dir"`
+	TrustedProxies       []string                    `mapstructure:"trusted_proxies" toml:"trusted_proxies" json:"trusted_proxies" validate:"omitempty,dive,cidr"`
+	ProxyProtocol        bool                        `mapstructure:"proxy_protocol" toml:"proxy_protocol" json:"proxy_protocol"`
+	TrafficFlushInterval int                         `mapstructure:"traffic_flush_interval" toml:"traffic_flush_interval" json:"traffic_flush_interval" validate:"numeric,gte=0"`
+	ScheduleInterval     int                         `mapstructure:"schedule_interval" toml:"schedule_interval" json:"schedule_interval" validate:"numeric,gte=0"`
+	ConnectionRetention  int                         `mapstructure:"connection_retention" toml:"connection_retention" json:"connection_retention" validate:"numeric,gte=0"`
+	LogRetention         int                         `mapstructure:"log_retention" toml:"log_retention" json:"log_retention" validate:"numeric,gte=0"`
+	HideDestination      bool                        `mapstructure:"hide_destination" toml:"hide_destination" json:"hide_destination"`
+	NodeName             string                      `mapstructure:"node_name" toml:"node_name" json:"node_name"`
+	HeartbeatInterval    int                         `mapstructure:"heartbeat_interval" toml:"heartbeat_interval" json:"heartbeat_interval" validate:"numeric,gte=0"`
+	SessionKeys          []string                    `mapstructure:"session_keys" toml:"session_keys" json:"session_keys" validate:"omitempty,dive,min=32"`
+	SessionStore         string                      `mapstructure:"session_store" toml:"session_store" json:"session_store" validate:"omitempty,oneof=cookie db"`
+	SessionIdleTimeout   int                         `mapstructure:"session_idle_timeout" toml:"session_idle_timeout" json:"session_idle_timeout" validate:"numeric,gte=0"`
+	SessionLifetime      int                         `mapstructure:"session_lifetime" toml:"session_lifetime" json:"session_lifetime" validate:"numeric,gte=0,lte=2592000"`
+	Registration         string                      `mapstructure:"registration" toml:"registration" json:"registration" validate:"omitempty,oneof=open closed"`
+	DefaultPlan          uint                        `mapstructure:"default_plan" toml:"default_plan" json:"default_plan"`
+	GeoIP                string                      `mapstructure:"geoip" toml:"geoip" json:"geoip" validate:"omitempty,file"`
+	ACL                  []*ACLRuleTOML              `mapstructure:"acl" toml:"acl" json:"acl" validate:"omitempty,dive"`
+	Categories           map[string]*DestinationTOML `mapstructure:"categories" toml:"categories" json:"categories" validate:"omitempty,dive"`
+	TLS                  *TLSToml                    `mapstructure:"tls" toml:"tls" json:"tls" validate:"omitempty"`
 }
 
 type serverGo struct {
-	Port          uint16
-	AdminPassword string
+	Port                 uint16
+	AdminPassword        string
+	AdminPath            string
+	AdminNetwork         string
+	AdminAddr            string
+	AdminAllow           []*net.IPNet
+	Pretend              *url.URL
+	PretendDir           string
+	TrustedProxies       []*net.IPNet
+	ProxyProtocol        bool
+	TrafficFlushInterval time.Duration
+	ScheduleInterval     time.Duration
+	ConnectionRetention  time.Duration
+	LogRetention         time.Duration
+	HideDestination      bool
+	NodeName             string
+	HeartbeatInterval    time.Duration
+	SessionKeys          []string //the first key signs the session cookies, all of them verify
+	SessionStore         string
+	SessionIdleTimeout   time.Duration
+	SessionLifetime      time.Duration
+	RegistrationOpen     bool //users can sign up through the web API
+	DefaultPlan          uint //plan of the users who sign up
+	GeoIP                string
+	ACL                  []*ACLRule
+	Categories           map[string]*Destination
+	TLS                  *TLSGo
 }
 
 func (st *ServerTOML) Init() (sg *serverGo, err error) {
 	sg = &serverGo{
-		Port:          uint16(st.Port),
-		AdminPassword: st.AdminPassword,
+		Port:                 uint16(st.Port),
+		AdminPassword:        st.AdminPassword,
+		AdminPath:            strings.TrimSuffix(st.AdminPath, "/"),
+		PretendDir:           st.PretendDir,
+		ConnectionRetention:  time.Duration(st.ConnectionRetention) * 24 * time.Hour,
+		LogRetention:         time.Duration(st.LogRetention) * 24 * time.Hour,
+		HideDestination:      st.HideDestination,
+		NodeName:             st.NodeName,
+		HeartbeatInterval:    time.Duration(st.HeartbeatInterval) * time.Second,
+		SessionKeys:          st.SessionKeys,
+		SessionStore:         st.SessionStore,
+		SessionIdleTimeout:   time.Duration(st.SessionIdleTimeout) * time.Second,
+		SessionLifetime:      time.Duration(st.SessionLifetime) * time.Second,
+		RegistrationOpen:     st.Registration != RegistrationClosed,
+		DefaultPlan:          st.DefaultPlan,
+		GeoIP:                st.GeoIP,
+		ProxyProtocol:        st.ProxyProtocol,
+		TrafficFlushInterval: time.Duration(st.TrafficFlushInterval) * time.Second,
+		ScheduleInterval:     time.Duration(st.ScheduleInterval) * time.Second,
+	}
+	if sg.TrafficFlushInterval == 0 {
+		sg.TrafficFlushInterval = DefaultTrafficFlushInterval
+	}
+	if sg.ScheduleInterval == 0 {
+		sg.ScheduleInterval = DefaultScheduleInterval
+	}
+	if sg.ConnectionRetention == 0 {
+		sg.ConnectionRetention = DefaultConnectionRetention
+	}
+	if sg.LogRetention == 0 {
+		sg.LogRetention = DefaultLogRetention
+	}
+	if sg.HeartbeatInterval == 0 {
+		sg.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if sg.SessionStore == "" {
+		sg.SessionStore = SessionStoreCookie
+	}
+	if sg.SessionIdleTimeout == 0 {
+		sg.SessionIdleTimeout = DefaultSessionIdleTimeout
+	}
+	if sg.SessionLifetime == 0 {
+		sg.SessionLifetime = DefaultSessionLifetime
+	}
+	if sg.DefaultPlan == 0 {
+		sg.DefaultPlan = DefaultPlanID
+	}
+	if sg.NodeName == "" {
+		sg.NodeName, err = os.Hostname()
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+	}
+	if sg.AdminPath == "" {
+		sg.AdminPath = DefaultAdminPath
+	}
+	if strings.HasPrefix(st.AdminAddr, "unix:") {
+		sg.AdminNetwork = "unix"
+		sg.AdminAddr = strings.TrimPrefix(st.AdminAddr, "unix:")
+	} else if st.AdminAddr != "" {
+		sg.AdminNetwork = "tcp"
+		sg.AdminAddr = st.AdminAddr
+	}
+	for _, cidr := range st.AdminAllow {
+		_, block, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.WithField("server.admin_allow", cidr).Error(err)
+			return nil, err
+		}
+		sg.AdminAllow = append(sg.AdminAllow, block)
+	}
+	for _, cidr := range st.TrustedProxies {
+		_, block, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.WithField("server.trusted_proxies", cidr).Error(err)
+			return nil, err
+		}
+		sg.TrustedProxies = append(sg.TrustedProxies, block)
+	}
+	if st.Pretend != "" {
+		sg.Pretend, err = url.Parse(st.Pretend)
+		if err != nil {
+			log.WithField("server.pretend", st.Pretend).Error(err)
+			return nil, err
+		}
+		if sg.Pretend.Scheme != "http" && sg.Pretend.Scheme != "https" {
+			err = errors.New("unsupported scheme")
+			log.WithField("server.pretend", st.Pretend).Error(err)
+			return nil, err
+		}
+	}
+	for _, art := range st.ACL {
+		rule, err := art.Init()
+		if err != nil {
+			return nil, err
+		}
+		if len(rule.Countries) > 0 && sg.GeoIP == "" {
+			err = errors.New("server.geoip is required by the countries of server.acl")
+			log.WithField("server.acl.countries", art.Countries).Error(err)
+			return nil, err
+		}
+		sg.ACL = append(sg.ACL, rule)
+	}
+	sg.Categories = map[string]*Destination{}
+	for name, dt := range st.Categories {
+		dest, err := dt.Init("server.categories." + name)
+		if err != nil {
+			return nil, err
+		}
+		if len(dest.Countries) > 0 && sg.GeoIP == "" {
+			err = errors.New("server.geoip is required by the countries of server.categories")
+			log.WithField("server.categories."+name+".countries", dt.Countries).Error(err)
+			return nil, err
+		}
+		sg.Categories[name] = dest
+	}
+	if st.TLS != nil {
+		sg.TLS, err = st.TLS.Init()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"server.tls.cert_file": st.TLS.CertFile,
+				"server.tls.key_file":  st.TLS.KeyFile,
+			}).Error(err)
+			return nil, err
+		}
+	}
+	if sg.Camouflaged() && sg.AdminPath == DefaultAdminPath && !sg.AdminSeparated() {
+		log.Warn("server.admin_path is not set, the admin web UI is hidden behind the pretend site")
 	}
 	return sg, nil
 }
+
+// Camouflaged reports whether unauthenticated requests are served with a decoy site
+func (sg *serverGo) Camouflaged() bool {
+	return sg.Pretend != nil || sg.PretendDir != ""
+}
+
+// AdminSeparated reports whether the admin web API has its own listener instead of sharing the public one
+func (sg *serverGo) AdminSeparated() bool {
+	return sg.AdminAddr != ""
+}
+
+// TrustedProxy reports whether the forwarding headers sent from ip can be trusted
+func (sg *serverGo) TrustedProxy(ip net.IP) bool {
+	for _, block := range sg.TrustedProxies {
+		if block.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
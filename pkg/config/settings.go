@@ -0,0 +1,113 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Redacted replaces the secrets in the configuration shown by the web API
+const Redacted = "******"
+
+// runtimeSettings are the keys which can be changed through the web API without a restart,
+// their values are stored in the database as JSON and override the configuration file
+var runtimeSettings = map[string]func(mc *ConfigTOML) interface{}{
+	"log.level":            func(mc *ConfigTOML) interface{} { return &mc.Log.Level },
+	"server.registration":  func(mc *ConfigTOML) interface{} { return &mc.Server.Registration },
+	"server.default_plan":  func(mc *ConfigTOML) interface{} { return &mc.Server.DefaultPlan },
+	"server.acl":           func(mc *ConfigTOML) interface{} { return &mc.Server.ACL },
+	"server.log_retention": func(mc *ConfigTOML) interface{} { return &mc.Server.LogRetention },
+}
+
+// RuntimeSettings returns the sorted keys which can be overridden by the settings
+func RuntimeSettings() []string {
+	keys := make([]string, 0, len(runtimeSettings))
+	for key := range runtimeSettings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// overlay returns a copy of mc overridden by the settings, mc is not modified
+func overlay(mc *ConfigTOML, settings map[string]string) (*ConfigTOML, error) {
+	ec := *mc
+	if mc.Log != nil {
+		lt := *mc.Log
+		ec.Log = &lt
+	}
+	if mc.Server != nil {
+		st := *mc.Server
+		ec.Server = &st
+	}
+	for key, value := range settings {
+		field, ok := runtimeSettings[key]
+		if !ok {
+			return nil, fmt.Errorf("%s cannot be changed at runtime", key)
+		}
+		if strings.HasPrefix(key, "server.") && ec.Server == nil {
+			continue
+		}
+		target := field(&ec)
+		//the slices of ec still share their arrays with mc
+		reflect.ValueOf(target).Elem().Set(reflect.Zero(reflect.TypeOf(target).Elem()))
+		err := json.Unmarshal([]byte(value), target)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return &ec, nil
+}
+
+// ApplySettings replaces the settings overriding the configuration file, the result is validated
+// as a whole before anything is applied
+func (conf *ConfigGo) ApplySettings(settings map[string]string) error {
+	conf.mutex.Lock()
+	defer conf.mutex.Unlock()
+	_, err := conf.apply(conf.toml, settings)
+	return err
+}
+
+// ValidateSettings checks the settings overriding the configuration file like ApplySettings, nothing is applied
+func (conf *ConfigGo) ValidateSettings(settings map[string]string) error {
+	conf.mutex.Lock()
+	defer conf.mutex.Unlock()
+	_, err := conf.prepare(conf.toml, settings)
+	return err
+}
+
+// Settings returns a copy of the settings overriding the configuration file
+func (conf *ConfigGo) Settings() map[string]string {
+	conf.mutex.Lock()
+	defer conf.mutex.Unlock()
+	settings := make(map[string]string, len(conf.settings))
+	for key, value := range conf.settings {
+		settings[key] = value
+	}
+	return settings
+}
+
+// Redacted returns the effective configuration with the secrets replaced
+func (conf *ConfigGo) Redacted() *ConfigTOML {
+	conf.mutex.Lock()
+	defer conf.mutex.Unlock()
+	ec := *conf.effective
+	ec.Client = nil
+	if ec.Server != nil {
+		st := *ec.Server
+		st.AdminPassword = Redacted
+		st.SessionKeys = make([]string, len(ec.Server.SessionKeys))
+		for k := range st.SessionKeys {
+			st.SessionKeys[k] = Redacted
+		}
+		ec.Server = &st
+	}
+	if ec.DB != nil {
+		dt := *ec.DB
+		dt.Password = Redacted
+		ec.DB = &dt
+	}
+	return &ec
+}
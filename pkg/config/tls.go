@@ -0,0 +1,32 @@
+package config
+
+import (
+	"path/filepath"
+)
+
+type TLSToml struct {
+	Port     int    `mapstructure:"port" toml:"port" json:"port" validate:"numeric,gte=0,lte=65535,required"`
+	CertFile string `mapstructure:"cert_file" toml:"cert_file" json:"cert_file" validate:"file,required"`
+	KeyFile  string `mapstructure:"key_file" toml:"key_file" json:"key_file" validate:"file,required"`
+}
+
+type TLSGo struct {
+	Port     uint16
+	CertFile string
+	KeyFile  string
+}
+
+func (tt *TLSToml) Init() (tg *TLSGo, err error) {
+	tg = &TLSGo{
+		Port: uint16(tt.Port),
+	}
+	tg.CertFile, err = filepath.Abs(tt.CertFile)
+	if err != nil {
+		return nil, err
+	}
+	tg.KeyFile, err = filepath.Abs(tt.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return tg, nil
+}
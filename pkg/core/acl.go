@@ -0,0 +1,126 @@
+package core
+
+import (
+	"net"
+
+	"github.com/iyouport-org/relaybaton/pkg/config"
+	"github.com/oschwald/geoip2-golang"
+	log "github.com/sirupsen/logrus"
+)
+
+// ACL decides whether a destination can be connected by the server.
+// Rules are evaluated in order and the first matching rule wins, destinations matching no rule are allowed.
+type ACL struct {
+	rules       []*config.ACLRule
+	categories  map[string]*config.Destination
+	geoIPDB     *geoip2.Reader
+	domainRules bool //some rule or category matches domains
+}
+
+// target is a destination requested by a client, its country is looked up on demand
+type target struct {
+	acl           *ACL
+	ip            net.IP
+	port          uint16
+	domain        string
+	country       string
+	countryLoaded bool
+}
+
+func NewACL(conf *config.ConfigGo) (*ACL, error) {
+	serverConf := conf.Server()
+	acl := &ACL{
+		rules:      serverConf.ACL,
+		categories: serverConf.Categories,
+	}
+	for _, rule := range acl.rules {
+		acl.domainRules = acl.domainRules || len(rule.Destination.Domains) > 0
+	}
+	for _, dest := range acl.categories {
+		acl.domainRules = acl.domainRules || len(dest.Domains) > 0
+	}
+	if serverConf.GeoIP != "" {
+		var err error
+		acl.geoIPDB, err = geoip2.Open(serverConf.GeoIP)
+		if err != nil {
+			log.WithField("server.geoip", serverConf.GeoIP).Error(err)
+			return nil, err
+		}
+	}
+	return acl, nil
+}
+
+func (acl *ACL) target(ip net.IP, port uint16, domain string) *target {
+	return &target{
+		acl:    acl,
+		ip:     ip,
+		port:   port,
+		domain: domain,
+	}
+}
+
+// Allow checks the destination ip and port, domain is the domain name requested by the client if any
+func (acl *ACL) Allow(ip net.IP, port uint16, domain string) bool {
+	t := acl.target(ip, port, domain)
+	for _, rule := range acl.rules {
+		if t.match(rule.Destination) {
+			return rule.Allow
+		}
+	}
+	return true
+}
+
+// HasDomainRules reports whether some rule or category matches domains
+func (acl *ACL) HasDomainRules() bool {
+	return acl.domainRules
+}
+
+// Category returns the first of categories which the destination belongs to, or "" if none
+func (acl *ACL) Category(categories []string, ip net.IP, port uint16, domain string) string {
+	t := acl.target(ip, port, domain)
+	for _, name := range categories {
+		dest, ok := acl.categories[name]
+		if ok && t.match(dest) {
+			return name
+		}
+	}
+	return ""
+}
+
+func (t *target) match(dest *config.Destination) bool {
+	if !dest.MatchPort(t.port) || !dest.MatchIP(t.ip) {
+		return false
+	}
+	if len(dest.Domains) > 0 && (t.domain == "" || !dest.MatchDomain(t.domain)) {
+		return false
+	}
+	if len(dest.Countries) > 0 {
+		if !t.countryLoaded {
+			t.country = t.acl.country(t.ip)
+			t.countryLoaded = true
+		}
+		if !dest.MatchCountry(t.country) {
+			return false
+		}
+	}
+	return true
+}
+
+func (acl *ACL) country(ip net.IP) string {
+	if acl.geoIPDB == nil {
+		return ""
+	}
+	record, err := acl.geoIPDB.Country(ip)
+	if err != nil {
+		log.WithField("ip", ip.String()).Error(err)
+		return ""
+	}
+	return record.Country.IsoCode
+}
+
+func (acl *ACL) Close() error {
+	if acl.geoIPDB == nil {
+		return nil
+	}
+	return acl.geoIPDB.Close()
+}
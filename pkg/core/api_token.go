@@ -0,0 +1,99 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	apiTokenPrefix = "rb_"
+	apiTokenTouch  = time.Minute //last_used_at is only updated when older
+)
+
+var ErrAPIToken = errors.New("invalid, revoked or expired API token")
+
+// bearerToken returns the token of the Authorization header of the request
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")), true
+}
+
+// tokenRole returns RoleAdmin if the API token is valid and its scopes allow the request
+func (server *Server) tokenRole(c *gin.Context, token string) (uint, error) {
+	apiToken := model.APIToken{}
+	result := server.DB.DB.Where("token_hash = ?", hashToken(token)).Limit(1).Find(&apiToken)
+	if result.Error != nil {
+		return model.RoleNone, result.Error
+	}
+	now := time.Now()
+	if result.RowsAffected == 0 || apiToken.Expired(now) {
+		log.WithField("client_ip", c.ClientIP()).Warn(ErrAPIToken)
+		return model.RoleNone, ErrAPIToken
+	}
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) > apiTokenTouch {
+		err := server.DB.DB.Model(&apiToken).UpdateColumn("last_used_at", now).Error
+		if err != nil {
+			log.Error(err)
+		}
+	}
+	if !server.tokenAllows(c, apiToken) {
+		log.WithFields(log.Fields{
+			"token":  apiToken.Name,
+			"method": c.Request.Method,
+			"path":   c.FullPath(),
+		}).Warn("request out of the scopes of the API token")
+		return model.RoleNone, nil
+	}
+	return model.RoleAdmin, nil
+}
+
+// tokenAllows reports whether the scopes of the API token cover the request
+func (server *Server) tokenAllows(c *gin.Context, apiToken model.APIToken) bool {
+	if c.Request.Method == "GET" || c.Request.Method == "HEAD" {
+		return apiToken.HasScope(model.ScopeRead) || apiToken.HasScope(model.ScopeUserAdmin)
+	}
+	if !apiToken.HasScope(model.ScopeUserAdmin) {
+		return false
+	}
+	path := "/" + strings.TrimLeft(strings.TrimPrefix(c.FullPath(), server.ConfigGo.Server().AdminPath), "/")
+	for _, prefix := range []string{"/user", "/plan"} {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// newAPIToken returns a random token and its prefix shown in the lists
+func newAPIToken() (token string, prefix string) {
+	token = apiTokenPrefix + hex.EncodeToString(securecookie.GenerateRandomKey(32))
+	return token, token[:len(apiTokenPrefix)+8]
+}
+
+// sessionUsername returns the name of the logged in user, API tokens cannot be used
+func (server *Server) sessionUsername(c *gin.Context) (string, error) {
+	userID := server.sessionUserID(c)
+	if userID == "admin" {
+		return "admin", nil
+	}
+	id, ok := userID.(uint)
+	if !ok {
+		return "", errors.New("not logged in")
+	}
+	user := &model.User{}
+	err := server.DB.DB.First(user, id).Error
+	if err != nil {
+		return "", err
+	}
+	return user.Username, nil
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// CertReloader keeps the server certificate in memory and reloads it when the
+// certificate or key file changes on disk
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	mutex    sync.RWMutex
+	cert     *tls.Certificate
+	watcher  *fsnotify.Watcher
+}
+
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	reloader := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	err := reloader.Reload()
+	if err != nil {
+		return nil, err
+	}
+	reloader.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	//watch the directories, certificate renewal tools usually replace the files instead of writing to them
+	for _, dir := range []string{filepath.Dir(certFile), filepath.Dir(keyFile)} {
+		err = reloader.watcher.Add(dir)
+		if err != nil {
+			log.WithField("dir", dir).Error(err)
+			reloader.watcher.Close()
+			return nil, err
+		}
+	}
+	go reloader.watch()
+	return reloader, nil
+}
+
+func (reloader *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"cert_file": reloader.certFile,
+			"key_file":  reloader.keyFile,
+		}).Error(err)
+		return err
+	}
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+	reloader.cert = &cert
+	return nil
+}
+
+func (reloader *CertReloader) watch() {
+	for {
+		select {
+		case event, ok := <-reloader.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			if event.Name != reloader.certFile && event.Name != reloader.keyFile {
+				continue
+			}
+			if reloader.Reload() == nil {
+				log.WithField("file", event.Name).Info("certificate reloaded")
+			}
+		case err, ok := <-reloader.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Error(err)
+		}
+	}
+}
+
+func (reloader *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mutex.RLock()
+	defer reloader.mutex.RUnlock()
+	return reloader.cert, nil
+}
+
+func (reloader *CertReloader) Close() error {
+	return reloader.watcher.Close()
+}
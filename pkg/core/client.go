@@ -34,6 +34,7 @@ type Client struct {
 	conns    *Map
 	shutdown chan byte
 	router   *Router
+	traffic  map[string]*TrafficCounter //cumulative traffic by route
 }
 
 func NewClient(lc fx.Lifecycle, conf *config.ConfigGo, pool *goroutine.Pool, router *Router) *Client {
@@ -44,6 +45,10 @@ func NewClient(lc fx.Lifecycle, conf *config.ConfigGo, pool *goroutine.Pool, rou
 		conns:     NewMap(),
 		shutdown:  make(chan byte, 10),
 		router:    router,
+		traffic: map[string]*TrafficCounter{
+			RouteProxy:  {},
+			RouteDirect: {},
+		},
 	}
 
 	client.httpServer = &HTTPServer{
@@ -66,7 +71,7 @@ func NewClient(lc fx.Lifecycle, conf *config.ConfigGo, pool *goroutine.Pool, rou
 }
 
 func (client *Client) Run() error {
-	err := gnet.Serve(client, fmt.Sprintf("tcp://:%d", client.Client.Port),
+	err := gnet.Serve(client, fmt.Sprintf("tcp://:%d", client.Client().Port),
 		gnet.WithMulticore(true),
 		//gnet.WithReusePort(true),
 		gnet.WithLogger(log.StandardLogger()),
@@ -123,17 +128,25 @@ func (client *Client) React(frame []byte, c gnet.Conn) (out []byte, action gnet.
 				action = gnet.Close
 				return
 			}
-			conn.dstAddr, err = GetDstAddrFromRequest(request)
+			dstAddr, err := GetDstAddrFromRequest(request)
 			if err != nil {
 				log.Error(err)
 				action = gnet.Close
 				return
 			}
+			dstDomain := ""
+			if request.ATyp == socks5.ATypeDomainName {
+				dstDomain = string(request.DstAddr[1:])
+			}
+			conn.setDestination(dstAddr, dstDomain)
 			conn.cmd = request.Cmd
 			if client.router.Select(conn.dstAddr.(*net.TCPAddr).IP) {
 				resp, err := conn.DialWs(request)
 				if err != nil {
 					log.Error(err)
+					if repCode, convErr := strconv.Atoi(resp.Get("reply")); convErr == nil {
+						out = socks5.NewReply(byte(repCode), socks5.ATypeIPv4, net.IPv4(127, 0, 0, 1).To4(), client.Client().Port).Pack()
+					}
 					action = gnet.Close
 					return
 				}
@@ -144,8 +157,9 @@ func (client *Client) React(frame []byte, c gnet.Conn) (out []byte, action gnet.
 					action = gnet.Close
 					return
 				}
-				reply := socks5.NewReply(byte(repCode), socks5.ATypeIPv4, net.IPv4(127, 0, 0, 1).To4(), client.Client.Port)
+				reply := socks5.NewReply(byte(repCode), socks5.ATypeIPv4, net.IPv4(127, 0, 0, 1).To4(), client.Client().Port)
 				out = reply.Pack()
+				conn.setRoute(RouteProxy, client.traffic[RouteProxy])
 				err = client.Submit(conn.Run)
 				if err != nil {
 					log.Error(err)
@@ -155,14 +169,16 @@ func (client *Client) React(frame []byte, c gnet.Conn) (out []byte, action gnet.
 				conn.status = StatusAccepted
 				return out, gnet.None
 			} else { //direct
-				conn.tcpConn, err = net.Dial("tcp", conn.dstAddr.String())
+				tcpConn, err := net.Dial("tcp", conn.dstAddr.String())
 				if err != nil {
 					log.WithField("Dst Addr", conn.dstAddr.String()).Error(err)
 					action = gnet.Close
 					return
 				}
-				reply := socks5.NewReply(socks5.RepSucceeded, socks5.ATypeIPv4, net.IPv4(127, 0, 0, 1).To4(), client.Client.Port)
+				conn.setTCPConn(tcpConn)
+				reply := socks5.NewReply(socks5.RepSucceeded, socks5.ATypeIPv4, net.IPv4(127, 0, 0, 1).To4(), client.Client().Port)
 				out = reply.Pack()
+				conn.setRoute(RouteDirect, client.traffic[RouteDirect])
 				err = client.Submit(conn.DirectConnect)
 				if err != nil {
 					log.Error(err)
@@ -174,7 +190,8 @@ func (client *Client) React(frame []byte, c gnet.Conn) (out []byte, action gnet.
 			}
 		case StatusAccepted:
 			var err error
-			if client.router.Select(conn.dstAddr.(*net.TCPAddr).IP) {
+			conn.addUp(len(frame))
+			if conn.route == RouteProxy {
 				err = conn.remoteConn.WriteMessage(websocket.BinaryMessage, frame)
 			} else { //direct
 				_, err = conn.tcpConn.Write(frame)
@@ -214,7 +231,7 @@ func (client *Client) HandleMethodRequest(data []byte) (b []byte, action gnet.Ac
 }
 
 func (client *Client) OnOpened(c gnet.Conn) (out []byte, action gnet.Action) {
-	conn := NewConn(c, client.Client)
+	conn := NewConn(c, client.Client())
 	client.conns.Put(conn)
 	return out, gnet.None
 }
@@ -249,17 +266,46 @@ func (client *Client) OnClosed(c gnet.Conn, err error) (action gnet.Action) {
 	return gnet.None
 }
 
+// ApplyConfig picks up the settings changed by a configuration reload,
+// the upstream server settings are used by the new connections
+func (client *Client) ApplyConfig() {
+	mode := client.router.Mode()
+	proxyAll := client.Client().ProxyAll
+	if proxyAll && mode != RouteModeGlobal {
+		mode = RouteModeGlobal
+	} else if !proxyAll && mode == RouteModeGlobal {
+		mode = RouteModeRule
+	} else {
+		return
+	}
+	err := client.router.SetMode(mode)
+	if err != nil {
+		log.WithField("mode", mode).Error(err)
+	}
+}
+
 func (client *Client) OnInitComplete(svr gnet.Server) (action gnet.Action) {
 	go func() {
 		err := client.httpServer.Serve()
 		log.Error(err)
 	}()
+	if client.Client().ControlPort != 0 {
+		control := ControlServer{
+			Client: client,
+		}
+		go func() {
+			err := control.Serve()
+			if err != nil {
+				log.Error(err)
+			}
+		}()
+	}
 	transparent := RedirServer{
 		Client: client,
 	}
 	go transparent.Run()
 	go func() {
-		if !client.Client.ProxyAll {
+		if client.router.Mode() == RouteModeRule {
 			err := client.router.Update()
 			if err != nil {
 				log.Error(err)
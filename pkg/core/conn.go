@@ -11,6 +11,8 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/fasthttp/websocket"
@@ -28,14 +30,21 @@ const (
 )
 
 type Conn struct {
+	mutex      sync.Mutex //guards dstAddr, dstDomain, route, remoteConn and tcpConn, which are set by the event loop and read by the control server
+	id         uint64
 	key        string
 	status     uint8
 	dstAddr    net.Addr
+	dstDomain  string
 	cmd        socks5.Cmd
 	localConn  gnet.Conn
 	remoteConn *websocket.Conn
 	clientConf *config.ClientGo
 	tcpConn    net.Conn
+	start      time.Time
+	route      string
+	traffic    TrafficCounter
+	routeStats *TrafficCounter //traffic of all the connections on the route
 }
 
 func NewConn(gnetConn gnet.Conn, clientConf *config.ClientGo) *Conn {
@@ -45,14 +54,60 @@ func NewConn(gnetConn gnet.Conn, clientConf *config.ClientGo) *Conn {
 		localConn:  gnetConn,
 		remoteConn: nil,
 		clientConf: clientConf,
+		start:      time.Now(),
+	}
+}
+
+// setRoute records whether the connection is proxied or direct, stats is the traffic counter of the route
+func (conn *Conn) setRoute(route string, stats *TrafficCounter) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	conn.route = route
+	conn.routeStats = stats
+}
+
+// setDestination records the destination requested by the SOCKS client
+func (conn *Conn) setDestination(addr net.Addr, domain string) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	conn.dstAddr = addr
+	conn.dstDomain = domain
+}
+
+// setTCPConn records the connection to the destination of a direct route
+func (conn *Conn) setTCPConn(tcpConn net.Conn) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	conn.tcpConn = tcpConn
+}
+
+// destination returns the route and the destination, route is empty until the connection is routed
+func (conn *Conn) destination() (route string, addr net.Addr, domain string) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.route, conn.dstAddr, conn.dstDomain
+}
+
+func (conn *Conn) addUp(n int) {
+	conn.traffic.AddUp(n)
+	if conn.routeStats != nil {
+		conn.routeStats.AddUp(n)
+	}
+}
+
+func (conn *Conn) addDown(n int) {
+	conn.traffic.AddDown(n)
+	if conn.routeStats != nil {
+		conn.routeStats.AddDown(n)
 	}
 }
 
 func (conn *Conn) DialWs(request socks5.Request) (http.Header, error) {
+	serverAddr := net.JoinHostPort(conn.clientConf.Server, strconv.Itoa(int(conn.clientConf.ServerPort)))
 	u := url.URL{
 		Scheme: "wss",
-		Host:   conn.clientConf.Server + ":443",
-		Path:   "/",
+		Host:   serverAddr,
+		Path:   conn.clientConf.ServerPath,
 	}
 	esnikey, err := GetESNI(conn.clientConf.Server)
 	if err != nil {
@@ -66,7 +121,7 @@ func (conn *Conn) DialWs(request socks5.Request) (http.Header, error) {
 		},
 		NetDial: func(network, addr string) (net.Conn, error) {
 			//c, err := net.DialTimeout(network, "1.1.1.1:443", 15*time.Second)
-			c, err := net.DialTimeout(network, conn.clientConf.Server+":443", 15*time.Second)
+			c, err := net.DialTimeout(network, serverAddr, 15*time.Second)
 			if err != nil {
 				return nil, err
 			}
@@ -81,7 +136,7 @@ func (conn *Conn) DialWs(request socks5.Request) (http.Header, error) {
 		},
 		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
 			//c, err := net.DialTimeout(network, "1.1.1.1:443", 15*time.Second)
-			c, err := net.DialTimeout(network, conn.clientConf.Server+":443", 15*time.Second)
+			c, err := net.DialTimeout(network, serverAddr, 15*time.Second)
 			if err != nil {
 				return nil, err
 			}
@@ -102,8 +157,10 @@ func (conn *Conn) DialWs(request socks5.Request) (http.Header, error) {
 		log.Error(err)
 		return nil, err
 	}
-	var resp *http.Response
-	conn.remoteConn, resp, err = dialer.Dial(u.String(), header)
+	remoteConn, resp, err := dialer.Dial(u.String(), header)
+	conn.mutex.Lock()
+	conn.remoteConn = remoteConn
+	conn.mutex.Unlock()
 	if err != nil {
 		fields := log.Fields{}
 		if resp != nil {
@@ -111,6 +168,10 @@ func (conn *Conn) DialWs(request socks5.Request) (http.Header, error) {
 		}
 		fields["url"] = u.String()
 		log.WithFields(fields).Error(err)
+		if resp != nil {
+			//the server rejected the request, the reply header carries the SOCKS reply code
+			return resp.Header, err
+		}
 		return nil, err
 	}
 	err = conn.remoteConn.SetCompressionLevel(flate.BestCompression)
@@ -132,6 +193,7 @@ func (conn *Conn) Run() {
 		if len(b) == 0 {
 			continue
 		}
+		conn.addDown(len(b))
 		err = conn.localConn.AsyncWrite(b)
 		if err != nil {
 			log.Error(err)
@@ -150,6 +212,7 @@ func (conn *Conn) DirectConnect() {
 			conn.Close()
 			return
 		}
+		conn.addDown(n)
 		err = conn.localConn.AsyncWrite(b[:n])
 		if err != nil {
 			log.Error(err)
@@ -166,14 +229,17 @@ func (conn *Conn) Close() {
 			log.Error(err)
 		}
 	}
-	if conn.remoteConn != nil {
-		cErr := conn.remoteConn.Close()
+	conn.mutex.Lock()
+	remoteConn, tcpConn := conn.remoteConn, conn.tcpConn
+	conn.mutex.Unlock()
+	if remoteConn != nil {
+		cErr := remoteConn.Close()
 		if cErr != nil {
 			log.Error(cErr)
 		}
 	}
-	if conn.tcpConn != nil {
-		cErr := conn.tcpConn.Close()
+	if tcpConn != nil {
+		cErr := tcpConn.Close()
 		if cErr != nil {
 			log.Error(cErr)
 		}
@@ -191,6 +257,9 @@ func (conn *Conn) buildHeader() (http.Header, error) {
 	}
 	header.Add("network", "tcp") //TODO
 	header.Add("addr", conn.dstAddr.String())
+	if conn.dstDomain != "" {
+		header.Add("domain", conn.dstDomain)
+	}
 	header.Add("cmd", fmt.Sprintf("%d", conn.cmd))
 
 	return header, nil
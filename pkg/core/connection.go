@@ -0,0 +1,43 @@
+package core
+
+import (
+	"time"
+
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// recordConnection writes the audit record of a closed tunnel
+func (server *Server) recordConnection(tunnel *Tunnel) {
+	connection := &model.Connection{
+		UserID:      tunnel.UserID,
+		Username:    tunnel.Username,
+		ClientIP:    tunnel.ClientIP.String(),
+		StartedAt:   tunnel.Start,
+		EndedAt:     time.Now(),
+		Up:          tunnel.Up(),
+		Down:        tunnel.Down(),
+		CloseReason: tunnel.Reason(),
+	}
+	if !server.ConfigGo.Server().HideDestination {
+		connection.Addr = tunnel.Addr
+		connection.Domain = tunnel.Domain
+	}
+	result := server.DB.DB.Create(connection)
+	if result.Error != nil {
+		log.WithField("username", tunnel.Username).Error(result.Error)
+	}
+}
+
+// purgeConnections deletes the audit records older than server.connection_retention
+func (server *Server) purgeConnections() {
+	before := time.Now().Add(-server.ConfigGo.Server().ConnectionRetention)
+	result := server.DB.DB.Unscoped().Where("ended_at < ?", before).Delete(&model.Connection{})
+	if result.Error != nil {
+		log.Error(result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.WithField("rows", result.RowsAffected).Debug("connection records purged")
+	}
+}
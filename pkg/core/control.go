@@ -0,0 +1,175 @@
+package core
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+const controlConnectionsPath = "/connections"
+
+// ControlServer is the local HTTP API to inspect and control the client, it only listens on the loopback interface
+type ControlServer struct {
+	Client *Client
+}
+
+type ControlConnection struct {
+	ID       uint64    `json:"id"`
+	Route    string    `json:"route"`
+	Addr     string    `json:"addr"`
+	Domain   string    `json:"domain"`
+	Up       uint64    `json:"up"`
+	Down     uint64    `json:"down"`
+	Start    time.Time `json:"start"`
+	Duration int64     `json:"duration"` //seconds
+}
+
+type ControlTraffic struct {
+	Up   uint64 `json:"up"`
+	Down uint64 `json:"down"`
+}
+
+type ControlMode struct {
+	Mode string `json:"mode"`
+}
+
+func (server *ControlServer) Serve() error {
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", server.Client.Client().ControlPort))
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	return fasthttp.Serve(ln, server.requestHandler)
+}
+
+func (server *ControlServer) requestHandler(ctx *fasthttp.RequestCtx) {
+	if !server.authorize(ctx) {
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusUnauthorized), fasthttp.StatusUnauthorized)
+		return
+	}
+	path := string(ctx.Path())
+	switch {
+	case path == controlConnectionsPath && ctx.IsGet():
+		server.getConnections(ctx)
+	case strings.HasPrefix(path, controlConnectionsPath+"/") && ctx.IsDelete():
+		server.deleteConnection(ctx, strings.TrimPrefix(path, controlConnectionsPath+"/"))
+	case path == "/traffic" && ctx.IsGet():
+		server.getTraffic(ctx)
+	case path == "/mode" && ctx.IsGet():
+		server.writeJSON(ctx, ControlMode{
+			Mode: server.Client.router.Mode(),
+		})
+	case path == "/mode" && ctx.IsPut():
+		server.putMode(ctx)
+	default:
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+	}
+}
+
+// authorize checks the bearer token if client.control_token is set.
+// Requests from web pages are refused, so that a website cannot drive the API through the browser.
+func (server *ControlServer) authorize(ctx *fasthttp.RequestCtx) bool {
+	if len(ctx.Request.Header.Peek("Origin")) > 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(string(ctx.Host()))
+	if err != nil || (host != "localhost" && net.ParseIP(host) == nil) {
+		return false
+	}
+	token := server.Client.Client().ControlToken
+	if token == "" {
+		return true
+	}
+	auth := ctx.Request.Header.Peek(fasthttp.HeaderAuthorization)
+	if !bytes.HasPrefix(auth, []byte("Bearer ")) {
+		return false
+	}
+	return subtle.ConstantTimeCompare(auth[len("Bearer "):], []byte(token)) == 1
+}
+
+func (server *ControlServer) getConnections(ctx *fasthttp.RequestCtx) {
+	now := time.Now()
+	connections := []ControlConnection{}
+	for _, conn := range server.Client.conns.List() {
+		route, dstAddr, dstDomain := conn.destination()
+		if route == "" {
+			continue
+		}
+		connection := ControlConnection{
+			ID:       conn.id,
+			Route:    route,
+			Domain:   dstDomain,
+			Up:       conn.traffic.Up(),
+			Down:     conn.traffic.Down(),
+			Start:    conn.start,
+			Duration: int64(now.Sub(conn.start).Seconds()),
+		}
+		if dstAddr != nil {
+			connection.Addr = dstAddr.String()
+		}
+		connections = append(connections, connection)
+	}
+	server.writeJSON(ctx, connections)
+}
+
+func (server *ControlServer) deleteConnection(ctx *fasthttp.RequestCtx, idStr string) {
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+	conn, ok := server.Client.conns.GetByID(id)
+	if !ok {
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+		return
+	}
+	conn.Close()
+	server.writeJSON(ctx, id)
+}
+
+func (server *ControlServer) getTraffic(ctx *fasthttp.RequestCtx) {
+	traffic := map[string]ControlTraffic{}
+	for route, counter := range server.Client.traffic {
+		traffic[route] = ControlTraffic{
+			Up:   counter.Up(),
+			Down: counter.Down(),
+		}
+	}
+	server.writeJSON(ctx, traffic)
+}
+
+func (server *ControlServer) putMode(ctx *fasthttp.RequestCtx) {
+	request := ControlMode{}
+	err := json.Unmarshal(ctx.PostBody(), &request)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+	err = server.Client.router.SetMode(request.Mode)
+	if err != nil {
+		log.WithField("mode", request.Mode).Error(err)
+		ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+	log.WithField("mode", request.Mode).Info("routing mode switched")
+	server.writeJSON(ctx, request)
+}
+
+func (server *ControlServer) writeJSON(ctx *fasthttp.RequestCtx, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Error(err)
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+	ctx.SetContentType("application/json")
+	ctx.SetBody(b)
+}
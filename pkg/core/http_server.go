@@ -24,12 +24,12 @@ type hijackHandler struct {
 }
 
 func (server *HTTPServer) Serve() error {
-	ln4, err := reuseport.Listen("tcp4", fmt.Sprintf(":%d", server.Client.Client.HTTPPort))
+	ln4, err := reuseport.Listen("tcp4", fmt.Sprintf(":%d", server.Client.Client().HTTPPort))
 	if err != nil {
 		log.Error(err)
 		return err
 	}
-	ln6, err := reuseport.Listen("tcp6", fmt.Sprintf(":%d", server.Client.Client.HTTPPort))
+	ln6, err := reuseport.Listen("tcp6", fmt.Sprintf(":%d", server.Client.Client().HTTPPort))
 	if err != nil {
 		log.Error(err)
 		return err
@@ -59,7 +59,7 @@ func (server *HTTPServer) requestHandler(ctx *fasthttp.RequestCtx) {
 		ctx.Hijack(handler.Handle)
 	} else {
 		c := &fasthttp.Client{
-			Dial: fasthttpproxy.FasthttpSocksDialer(fmt.Sprintf("localhost:%d", server.Client.Client.Port)),
+			Dial: fasthttpproxy.FasthttpSocksDialer(fmt.Sprintf("localhost:%d", server.Client.Client().Port)),
 		}
 		err := c.Do(&ctx.Request, &ctx.Response)
 		if err != nil {
@@ -71,7 +71,7 @@ func (server *HTTPServer) requestHandler(ctx *fasthttp.RequestCtx) {
 func (handler *hijackHandler) Handle(c net.Conn) {
 	var wg sync.WaitGroup
 	wg.Add(2)
-	dialer, err := proxy.SOCKS5("tcp", fmt.Sprintf("localhost:%d", handler.server.Client.Client.Port), nil, nil)
+	dialer, err := proxy.SOCKS5("tcp", fmt.Sprintf("localhost:%d", handler.server.Client.Client().Port), nil, nil)
 	if err != nil {
 		log.Error(err)
 		return
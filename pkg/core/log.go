@@ -0,0 +1,98 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	logPageSize    = 100
+	logPageSizeMax = 1000
+)
+
+// logQuery filters the log records by the query of the request, filtered is false if there is no filter.
+// min_level is the least severe level included and max_level the most severe one.
+func (server *Server) logQuery(c *gin.Context) (query *gorm.DB, filtered bool, err error) {
+	query = server.DB.DB.Model(&model.Log{})
+	for key, cond := range map[string]string{"min_level": "level <= ?", "max_level": "level >= ?"} {
+		value, ok := c.GetQuery(key)
+		if !ok {
+			continue
+		}
+		level, err := log.ParseLevel(value)
+		if err != nil {
+			return nil, false, err
+		}
+		query = query.Where(cond, uint32(level))
+		filtered = true
+	}
+	for key, cond := range map[string]string{"since": "created_at >= ?", "until": "created_at < ?"} {
+		value, ok := c.GetQuery(key)
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, false, err
+		}
+		query = query.Where(cond, t)
+		filtered = true
+	}
+	for key, cond := range map[string]string{"func": "func LIKE ?", "file": "file LIKE ?", "q": "msg LIKE ?"} {
+		value, ok := c.GetQuery(key)
+		if !ok || value == "" {
+			continue
+		}
+		query = query.Where(cond, "%"+value+"%")
+		filtered = true
+	}
+	return query.Session(&gorm.Session{}), filtered, nil
+}
+
+// logPage applies the keyset pagination of the request to query, the page continues after the cursor ID
+func logPage(c *gin.Context, query *gorm.DB) (*gorm.DB, int, error) {
+	limit := logPageSize
+	if value, ok := c.GetQuery("limit"); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > logPageSizeMax {
+			return nil, 0, fmt.Errorf("limit is between 1 and %d", logPageSizeMax)
+		}
+		limit = n
+	}
+	order := c.DefaultQuery("order", "desc")
+	if order != "asc" && order != "desc" {
+		return nil, 0, errors.New("order is asc or desc")
+	}
+	if value, ok := c.GetQuery("cursor"); ok {
+		cursor, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, 0, errors.New("cursor is the ID of a log record")
+		}
+		if order == "asc" {
+			query = query.Where("id > ?", cursor)
+		} else {
+			query = query.Where("id < ?", cursor)
+		}
+	}
+	return query.Order("id " + order).Limit(limit), limit, nil
+}
+
+// purgeLogs deletes the log records older than server.log_retention
+func (server *Server) purgeLogs() {
+	before := time.Now().Add(-server.ConfigGo.Server().LogRetention)
+	result := server.DB.DB.Unscoped().Where("created_at < ?", before).Delete(&model.Log{})
+	if result.Error != nil {
+		log.Error(result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.WithField("rows", result.RowsAffected).Debug("log records purged")
+	}
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"fmt"
 	"net"
+	"sort"
 	"sync"
 
 	"github.com/emirpasic/gods/maps/hashmap"
@@ -11,6 +12,7 @@ import (
 type Map struct {
 	mutex   sync.RWMutex
 	connMap *hashmap.Map
+	nextID  uint64
 }
 
 func NewMap() *Map {
@@ -23,6 +25,8 @@ func NewMap() *Map {
 func (m *Map) Put(conn *Conn) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	m.nextID++
+	conn.id = m.nextID
 	m.connMap.Put(conn.key, conn)
 }
 
@@ -30,7 +34,36 @@ func (m *Map) Get(key string) (*Conn, bool) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 	v, ok := m.connMap.Get(key)
-	return v.(*Conn), ok
+	if !ok {
+		return nil, false
+	}
+	return v.(*Conn), true
+}
+
+// GetByID returns the connection of id assigned by Put
+func (m *Map) GetByID(id uint64) (*Conn, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, v := range m.connMap.Values() {
+		if conn := v.(*Conn); conn.id == id {
+			return conn, true
+		}
+	}
+	return nil, false
+}
+
+// List returns the connections ordered by ID
+func (m *Map) List() []*Conn {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	conns := make([]*Conn, 0, m.connMap.Size())
+	for _, v := range m.connMap.Values() {
+		conns = append(conns, v.(*Conn))
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].id < conns[j].id
+	})
+	return conns
 }
 
 func (m *Map) Delete(key string) {
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	failureBadRequest = "bad_request"
+	failureReserved   = "reserved"
+	failureACL        = "acl"
+	failurePolicy     = "policy"
+	failureLimit      = "limit"
+	failureDial       = "dial"
+	failureUpgrade    = "upgrade"
+	failureNode       = "node"
+)
+
+// Metrics are the Prometheus collectors of the server
+type Metrics struct {
+	registry        *prometheus.Registry
+	tunnelOpens     prometheus.Counter
+	tunnelFailures  *prometheus.CounterVec
+	tunnelBytes     *prometheus.CounterVec
+	authFailures    prometheus.Counter
+	dbLatency       *prometheus.HistogramVec
+	rateLimiterWait prometheus.Counter
+	bucketLookups   *prometheus.CounterVec
+	handler         http.Handler
+}
+
+func NewMetrics(server *Server) *Metrics {
+	metrics := &Metrics{
+		registry: prometheus.NewRegistry(),
+		tunnelOpens: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "relaybaton_tunnel_opens_total",
+			Help: "Number of tunnels opened.",
+		}),
+		tunnelFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "relaybaton_tunnel_failures_total",
+			Help: "Number of authenticated tunnel requests which failed to open, by reason.",
+		}, []string{"reason"}),
+		tunnelBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "relaybaton_tunnel_bytes_total",
+			Help: "Bytes relayed by the tunnels, by direction.",
+		}, []string{"direction"}),
+		authFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "relaybaton_auth_failures_total",
+			Help: "Number of tunnel requests which failed to authenticate.",
+		}),
+		dbLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "relaybaton_db_query_duration_seconds",
+			Help:    "Latency of the database queries on the tunnel path, by query.",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"query"}),
+		rateLimiterWait: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "relaybaton_rate_limiter_wait_seconds_total",
+			Help: "Time the tunnels spent waiting for the rate limiters.",
+		}),
+		bucketLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "relaybaton_rate_limiter_lookups_total",
+			Help: "Lookups of the rate limiter of a user, by result: hit when held in memory, miss when the user is read from the database.",
+		}, []string{"result"}),
+	}
+	metrics.registry.MustRegister(
+		metrics.tunnelOpens,
+		metrics.tunnelFailures,
+		metrics.tunnelBytes,
+		metrics.authFailures,
+		metrics.dbLatency,
+		metrics.rateLimiterWait,
+		metrics.bucketLookups,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "relaybaton_tunnels_active",
+			Help: "Number of tunnels open right now.",
+		}, func() float64 {
+			return float64(server.tunnels.Len())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "relaybaton_rate_limiters",
+			Help: "Number of rate limiters held in memory.",
+		}, func() float64 {
+			server.mutex.RLock()
+			defer server.mutex.RUnlock()
+			return float64(server.Map.Size())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "relaybaton_http_workers_busy",
+			Help: "Connections served by the goroutine pool of the HTTP server right now, a tunnel leaves the pool once upgraded.",
+		}, func() float64 {
+			return float64(server.httpServer.GetCurrentConcurrency())
+		}),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	metrics.handler = promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{})
+	return metrics
+}
+
+// observeQuery records the latency of a database query started at start
+func (server *Server) observeQuery(query string, start time.Time) {
+	server.metrics.dbLatency.WithLabelValues(query).Observe(time.Since(start).Seconds())
+}
+
+// ServeMetrics serves the metrics in the Prometheus format.
+// They are open to the scrapers on the separate admin listener, otherwise only to the admin.
+func (server *Server) ServeMetrics(c *gin.Context) {
+	if !server.ConfigGo.Server().AdminSeparated() {
+		role, err := server.GetRole(c)
+		if err != nil || role != model.RoleAdmin {
+			if err != nil {
+				log.Error(err)
+			}
+			c.AbortWithStatus(fasthttp.StatusNotFound)
+			return
+		}
+	}
+	server.metrics.handler.ServeHTTP(c.Writer, c.Request)
+}
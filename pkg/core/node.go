@@ -0,0 +1,185 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// nodeTimeoutHeartbeats is the number of missed heartbeats after which a node is considered down
+const nodeTimeoutHeartbeats = 3
+
+// NodeState is the membership of the server in the cluster of nodes sharing the database
+type NodeState struct {
+	mutex   sync.RWMutex
+	node    model.Node
+	remote  map[string]uint //tunnels of each user on the other live nodes
+	traffic TrafficCounter
+}
+
+func NewNodeState() *NodeState {
+	return &NodeState{
+		node: model.Node{
+			Enabled: true,
+		},
+		remote: map[string]uint{},
+	}
+}
+
+func (state *NodeState) ID() uint {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	return state.node.ID
+}
+
+// Accepting reports whether new tunnels can be opened on this node
+func (state *NodeState) Accepting() bool {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	return state.node.Accepting()
+}
+
+// Remote returns the number of tunnels of the user on the other nodes at their last heartbeat
+func (state *NodeState) Remote(username string) uint {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	return state.remote[username]
+}
+
+// nodeTimeout is the time after the last heartbeat when a node is considered down
+func (server *Server) nodeTimeout() time.Duration {
+	return nodeTimeoutHeartbeats * server.ConfigGo.Server().HeartbeatInterval
+}
+
+// registerNode adds the server to the node table, or takes over the record of the same name.
+// The enabled and draining flags set by the administrators are kept.
+func (server *Server) registerNode() error {
+	now := time.Now()
+	nodeName := server.ConfigGo.Server().NodeName
+	node := model.Node{}
+	result := server.DB.DB.Where("name = ?", nodeName).Limit(1).Find(&node)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		node = model.Node{
+			Name:          nodeName,
+			Enabled:       true,
+			StartedAt:     now,
+			LastHeartbeat: now,
+		}
+		result = server.DB.DB.Create(&node)
+	} else {
+		node.StartedAt = now
+		node.LastHeartbeat = now
+		node.Connections = 0
+		node.Up = 0
+		node.Down = 0
+		result = server.DB.DB.Model(&node).Select("started_at", "last_heartbeat", "connections", "up", "down").Updates(&node)
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	server.DB.DB.Where("node_id = ?", node.ID).Delete(&model.NodeUser{})
+	server.node.mutex.Lock()
+	server.node.node = node
+	server.node.mutex.Unlock()
+	log.WithFields(log.Fields{
+		"node":    node.Name,
+		"node_id": node.ID,
+	}).Info("node registered")
+	return nil
+}
+
+// heartbeat publishes the tunnels and traffic of this node, then loads its flags and the tunnels of the other nodes
+func (server *Server) heartbeat() {
+	start := time.Now()
+	defer server.observeQuery("heartbeat", start)
+	id := server.node.ID()
+	counts := server.tunnels.Counts()
+	var connections uint
+	nodeUsers := make([]model.NodeUser, 0, len(counts))
+	for username, n := range counts {
+		connections += n
+		nodeUsers = append(nodeUsers, model.NodeUser{
+			NodeID:      id,
+			Username:    username,
+			Connections: n,
+		})
+	}
+	node := model.Node{}
+	remote := map[string]uint{}
+	err := server.DB.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Node{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"connections":    connections,
+			"up":             server.node.traffic.Up(),
+			"down":           server.node.traffic.Down(),
+			"last_heartbeat": start,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		result = tx.Where("node_id = ?", id).Delete(&model.NodeUser{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if len(nodeUsers) > 0 {
+			result = tx.Create(&nodeUsers)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		result = tx.First(&node, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		var others []model.NodeUser
+		result = tx.Model(&model.NodeUser{}).
+			Select("node_users.username, SUM(node_users.connections) AS connections").
+			Joins("JOIN nodes ON nodes.id = node_users.node_id").
+			Where("node_users.node_id <> ? AND nodes.last_heartbeat > ? AND nodes.deleted_at IS NULL", id, start.Add(-server.nodeTimeout())).
+			Group("node_users.username").
+			Scan(&others)
+		if result.Error != nil {
+			return result.Error
+		}
+		for _, nodeUser := range others {
+			remote[nodeUser.Username] = nodeUser.Connections
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithField("node_id", id).Error(err)
+		return
+	}
+	server.node.mutex.Lock()
+	if node.Accepting() != server.node.node.Accepting() {
+		log.WithFields(log.Fields{
+			"node":     node.Name,
+			"enabled":  node.Enabled,
+			"draining": node.Draining,
+		}).Info("node state changed")
+	}
+	server.node.node = node
+	server.node.remote = remote
+	server.node.mutex.Unlock()
+}
+
+// deregisterNode withdraws the tunnels of this node from the cluster-wide limits on shutdown
+func (server *Server) deregisterNode() {
+	id := server.node.ID()
+	if id == 0 {
+		return
+	}
+	result := server.DB.DB.Where("node_id = ?", id).Delete(&model.NodeUser{})
+	if result.Error != nil {
+		log.WithField("node_id", id).Error(result.Error)
+	}
+	result = server.DB.DB.Model(&model.Node{}).Where("id = ?", id).Update("connections", 0)
+	if result.Error != nil {
+		log.WithField("node_id", id).Error(result.Error)
+	}
+}
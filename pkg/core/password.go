@@ -0,0 +1,104 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const passwordResetTTL = 24 * time.Hour
+
+var (
+	ErrPasswordFormat = errors.New("password is not a base64 SHA-512 digest")
+	ErrResetToken     = errors.New("invalid or expired reset token")
+)
+
+// decodePassword decodes a password sent by the clients, the base64 of its SHA-512 digest
+func decodePassword(password string) ([]byte, error) {
+	sha512key, err := base64.StdEncoding.DecodeString(password)
+	if err != nil {
+		return nil, err
+	}
+	if len(sha512key) != 64 {
+		return nil, ErrPasswordFormat
+	}
+	return sha512key, nil
+}
+
+// hashToken returns the hex SHA-256 of a reset or API token as stored in the database
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// setPassword changes the password of the user and revokes the sessions and the reset tokens of the user in tx
+func (server *Server) setPassword(tx *gorm.DB, user *model.User, sha512key []byte) error {
+	err := user.SetPassword(sha512key)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	user.PasswordChangedAt = &now
+	err = tx.Model(user).Select("password", "password_changed_at").Updates(user).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Unscoped().Where("user_id = ?", user.ID).Delete(&model.PasswordReset{}).Error
+	if err != nil {
+		return err
+	}
+	return server.revokeSessions(tx, user.ID)
+}
+
+// newPasswordReset issues a reset token for the user, replacing the previous ones
+func (server *Server) newPasswordReset(userID uint) (token string, reset *model.PasswordReset, err error) {
+	token = hex.EncodeToString(securecookie.GenerateRandomKey(32))
+	reset = &model.PasswordReset{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}
+	err = server.DB.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("user_id = ?", userID).Delete(&model.PasswordReset{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(reset).Error
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return token, reset, nil
+}
+
+// redeemPasswordReset sets the password of the user of the token, the token can only be used once
+func (server *Server) redeemPasswordReset(token string, sha512key []byte) (*model.User, error) {
+	user := &model.User{}
+	err := server.DB.DB.Transaction(func(tx *gorm.DB) error {
+		reset := model.PasswordReset{}
+		result := tx.Where("token_hash = ? AND expires_at > ?", hashToken(token), time.Now()).Limit(1).Find(&reset)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrResetToken
+		}
+		err := tx.First(user, reset.UserID).Error
+		if err != nil {
+			return err
+		}
+		return server.setPassword(tx, user, sha512key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.WithField("username", user.Username).Info("password changed")
+	return user, nil
+}
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"strconv"
+
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	"github.com/iyouport-org/relaybaton/pkg/socks5"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	ErrUDPNotAllowed   = errors.New("UDP is not allowed by the plan")
+	ErrPortNotAllowed  = errors.New("destination port is not allowed by the plan")
+	ErrCategoryBlocked = errors.New("destination category is blocked by the plan")
+)
+
+// checkPolicy checks the tunnel request against the policies of the plan of the user
+func (server *Server) checkPolicy(ctx *fasthttp.RequestCtx, plan model.Plan, ip net.IP, port uint16, domain string) (string, error) {
+	if !plan.AllowUDP && isUDPRequest(ctx) {
+		return "", ErrUDPNotAllowed
+	}
+	if !plan.AllowPort(port) {
+		return "", ErrPortNotAllowed
+	}
+	if category := server.getACL().Category(plan.BlockedCategoryList(), ip, port, domain); category != "" {
+		return category, ErrCategoryBlocked
+	}
+	return "", nil
+}
+
+func isUDPRequest(ctx *fasthttp.RequestCtx) bool {
+	if string(ctx.Request.Header.Peek("network")) == "udp" {
+		return true
+	}
+	cmd, err := strconv.Atoi(string(ctx.Request.Header.Peek("cmd")))
+	return err == nil && socks5.Cmd(cmd) == socks5.CmdUDPAssociate
+}
@@ -1,82 +1,108 @@
 package core
 
 import (
-	"errors"
+	"context"
 	"sync"
 	"time"
 )
 
+const (
+	minBurst = 1 << 14
+	//burstDuration is the time of traffic the bucket can hold when it is full
+	burstDuration = 125 * time.Millisecond
+)
+
+// RateLimiter is a token bucket shared by all the tunnels of a user, in both directions.
+// Tokens are refilled lazily on each call, so there is no goroutine per bucket.
 type RateLimiter struct {
-	bandwidth      uint
-	tokens         uint64
-	capacity       uint64
-	ticker         *time.Ticker
-	mutex          sync.Mutex
-	mutexWriteWait sync.Mutex
-	mutexWait      sync.Mutex
-	done           sync.WaitGroup
-	waiting        uint
+	mutex    sync.Mutex
+	rate     float64 //bytes per second, 0 for unlimited
+	capacity float64
+	tokens   float64
+	last     time.Time
+	lastUsed time.Time
 }
 
+// NewRateLimiter creates a bucket of bandwidth KB/s, 0 for unlimited
 func NewRateLimiter(bandwidth uint) *RateLimiter {
+	now := time.Now()
 	rl := &RateLimiter{
-		bandwidth: bandwidth,
-		tokens:    0,
-		ticker:    time.NewTicker(time.Millisecond),
-		capacity:  uint64(bandwidth << 4),
-		waiting:   0,
+		last:     now,
+		lastUsed: now,
 	}
-	go rl.Run()
+	rl.setBandwidth(bandwidth)
+	rl.tokens = rl.capacity
 	return rl
 }
 
-func (rateLimiter *RateLimiter) Run() {
-	for {
-		<-rateLimiter.ticker.C
-		rateLimiter.add(rateLimiter.bandwidth)
-	}
-}
-
-func (rateLimiter *RateLimiter) add(tokens uint) {
+// SetBandwidth changes the rate of the bucket, it applies from the next wait of each tunnel
+func (rateLimiter *RateLimiter) SetBandwidth(bandwidth uint) {
 	rateLimiter.mutex.Lock()
 	defer rateLimiter.mutex.Unlock()
-	result := rateLimiter.tokens + uint64(tokens)
-	if result < rateLimiter.capacity {
-		rateLimiter.tokens = result
-	} else {
+	rateLimiter.refill(time.Now())
+	rateLimiter.setBandwidth(bandwidth)
+	if rateLimiter.tokens > rateLimiter.capacity {
 		rateLimiter.tokens = rateLimiter.capacity
 	}
-	rateLimiter.mutexWriteWait.Lock()
-	defer rateLimiter.mutexWriteWait.Unlock()
-	if rateLimiter.waiting != 0 && rateLimiter.tokens >= uint64(rateLimiter.waiting) {
-		if rateLimiter.tokens > uint64(rateLimiter.waiting) {
-			rateLimiter.tokens -= uint64(rateLimiter.waiting)
-		} else {
-			rateLimiter.tokens = 0
-		}
-		rateLimiter.waiting = 0
-		rateLimiter.done.Done()
+}
+
+func (rateLimiter *RateLimiter) setBandwidth(bandwidth uint) {
+	rateLimiter.rate = float64(bandwidth) * 1000
+	rateLimiter.capacity = rateLimiter.rate * burstDuration.Seconds()
+	if rateLimiter.capacity < minBurst {
+		rateLimiter.capacity = minBurst
 	}
 }
 
-func (rateLimiter *RateLimiter) Wait(tokens uint) error {
-	rateLimiter.mutexWait.Lock()
-	defer rateLimiter.mutexWait.Unlock()
-	if uint64(tokens) > rateLimiter.capacity {
-		return errors.New("out of capacity")
+func (rateLimiter *RateLimiter) refill(now time.Time) {
+	elapsed := now.Sub(rateLimiter.last).Seconds()
+	rateLimiter.last = now
+	if elapsed <= 0 {
+		return
+	}
+	rateLimiter.tokens += elapsed * rateLimiter.rate
+	if rateLimiter.tokens > rateLimiter.capacity {
+		rateLimiter.tokens = rateLimiter.capacity
 	}
-	rateLimiter.mutexWriteWait.Lock()
-	rateLimiter.waiting = tokens
-	rateLimiter.done.Add(1)
-	rateLimiter.mutexWriteWait.Unlock()
-	rateLimiter.done.Wait()
-	return nil
 }
 
-func (rateLimiter *RateLimiter) Available() uint64 {
-	return rateLimiter.tokens
+// reserve takes n tokens from the bucket and returns how long the caller has to wait for them.
+// The bucket may go into debt, so that n can be larger than the capacity.
+func (rateLimiter *RateLimiter) reserve(n int) time.Duration {
+	rateLimiter.mutex.Lock()
+	defer rateLimiter.mutex.Unlock()
+	now := time.Now()
+	rateLimiter.lastUsed = now
+	if rateLimiter.rate == 0 {
+		return 0
+	}
+	rateLimiter.refill(now)
+	rateLimiter.tokens -= float64(n)
+	if rateLimiter.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-rateLimiter.tokens / rateLimiter.rate * float64(time.Second))
 }
 
-func (rateLimiter *RateLimiter) Capacity() uint64 {
-	return rateLimiter.capacity
+// WaitN blocks until n bytes are allowed to pass or ctx is done
+func (rateLimiter *RateLimiter) WaitN(ctx context.Context, n int) error {
+	delay := rateLimiter.reserve(n)
+	if delay == 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// IdleSince returns the last time the bucket was used
+func (rateLimiter *RateLimiter) IdleSince() time.Time {
+	rateLimiter.mutex.Lock()
+	defer rateLimiter.mutex.Unlock()
+	return rateLimiter.lastUsed
 }
@@ -25,7 +25,7 @@ type RedirServer struct {
 
 func (server *RedirServer) Run() {
 	var err error
-	server.listener, err = net.Listen("tcp", fmt.Sprintf(":%d", server.Client.Client.RedirPort))
+	server.listener, err = net.Listen("tcp", fmt.Sprintf(":%d", server.Client.Client().RedirPort))
 	if err != nil {
 		log.Error(err)
 		return
@@ -45,7 +45,7 @@ func (server *RedirServer) Run() {
 			log.Error(err)
 			continue
 		}
-		dialer, err := proxy.SOCKS5("tcp", fmt.Sprintf("localhost:%d", server.Client.Client.Port), nil, nil)
+		dialer, err := proxy.SOCKS5("tcp", fmt.Sprintf("localhost:%d", server.Client.Client().Port), nil, nil)
 		if err != nil {
 			log.Error(err)
 			continue
@@ -26,8 +26,15 @@ import (
 var reservedIP []*net.IPNet
 var IsMobile bool
 
+const (
+	RouteModeGlobal = "global" //proxy all traffic
+	RouteModeRule   = "rule"   //connect to the destinations in China directly
+	RouteModeDirect = "direct" //connect to all destinations directly
+)
+
 type Router struct {
 	on             bool
+	mode           string
 	compressedPath string
 	mmdbPath       string
 	mutex          sync.RWMutex
@@ -38,15 +45,9 @@ type Router struct {
 }
 
 func NewRouter(conf *config.ConfigGo) (*Router, error) {
-	if conf.Client.ProxyAll {
-		return &Router{
-			on:      false,
-			GeoIPDB: nil,
-			hashMap: hashmap.New(),
-		}, nil
-	}
 	router := &Router{
 		on:      true,
+		mode:    RouteModeRule,
 		GeoIPDB: nil,
 		conf:    conf,
 		hashMap: hashmap.New(),
@@ -65,22 +66,77 @@ func NewRouter(conf *config.ConfigGo) (*Router, error) {
 	router.compressedPath = exPath + "/geoip.mmdb.tar.gz"
 	router.mmdbPath = exPath + "/geoip.mmdb"
 	log.Debug(exPath) //test
+	if conf.Client().ProxyAll {
+		router.mode = RouteModeGlobal
+		return router, nil
+	}
+	err := router.openGeoIPDB()
+	if err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+// openGeoIPDB loads the GeoIP database if it has been downloaded, otherwise the router is switched off until updated
+func (router *Router) openGeoIPDB() error {
 	_, err := os.Stat(router.mmdbPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			router.SwitchOff()
-			return router, nil
+			return nil
 		} else {
 			log.Error(err)
-			return nil, err
+			return err
 		}
 	}
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
 	router.GeoIPDB, err = geoip2.Open(router.mmdbPath)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return err
 	}
-	return router, nil
+	return nil
+}
+
+// Mode returns the routing mode
+func (router *Router) Mode() string {
+	router.mutex.RLock()
+	defer router.mutex.RUnlock()
+	return router.mode
+}
+
+// SetMode switches the routing mode at runtime, the cached decisions are dropped.
+// The mode is only held by the router, read it with Mode
+func (router *Router) SetMode(mode string) error {
+	switch mode {
+	case RouteModeGlobal, RouteModeDirect:
+	case RouteModeRule:
+		router.mutex.RLock()
+		loaded := router.GeoIPDB != nil
+		router.mutex.RUnlock()
+		if !loaded {
+			err := router.openGeoIPDB()
+			if err != nil {
+				return err
+			}
+			go func() {
+				err := router.Update()
+				if err != nil {
+					log.Error(err)
+				}
+			}()
+		}
+	default:
+		return errors.New("unknown routing mode: " + mode)
+	}
+	router.mutex.Lock()
+	router.mode = mode
+	router.mutex.Unlock()
+	router.mutexMap.Lock()
+	router.hashMap.Clear()
+	router.mutexMap.Unlock()
+	return nil
 }
 
 func (router *Router) SwitchOn() {
@@ -111,7 +167,13 @@ func (router *Router) getGeoIP(ip net.IP) bool {
 		log.Debug("reserved")
 		return false
 	}
-	if !router.on {
+	switch router.mode {
+	case RouteModeGlobal:
+		return true
+	case RouteModeDirect:
+		return false
+	}
+	if !router.on || router.GeoIPDB == nil {
 		return true
 	} else {
 		country, err := router.GeoIPDB.Country(ip)
@@ -149,7 +211,7 @@ func (router *Router) Download() error {
 	log.Debug("Updating")
 	router.SwitchOff()
 	client := fasthttp.Client{
-		Dial: fasthttpproxy.FasthttpSocksDialer(fmt.Sprintf("localhost:%d", router.conf.Client.Port)),
+		Dial: fasthttpproxy.FasthttpSocksDialer(fmt.Sprintf("localhost:%d", router.conf.Client().Port)),
 	}
 	resp := make([]byte, 1<<22)
 	statusCode, body, err := client.Get(resp, "https://download.maxmind.com/app/geoip_download?edition_id=GeoLite2-Country&license_key=JvbzLLx7qBZT&suffix=tar.gz")
@@ -244,7 +306,7 @@ func (router *Router) Update() error {
 	sum := h.Sum(nil)
 
 	client := fasthttp.Client{
-		Dial: fasthttpproxy.FasthttpSocksDialer(fmt.Sprintf("localhost:%d", router.conf.Client.Port)),
+		Dial: fasthttpproxy.FasthttpSocksDialer(fmt.Sprintf("localhost:%d", router.conf.Client().Port)),
 	}
 	resp := make([]byte, 1<<10)
 	statusCode, body, err := client.Get(resp, "https://download.maxmind.com/app/geoip_download?edition_id=GeoLite2-Country&license_key=JvbzLLx7qBZT&suffix=tar.gz.sha256")
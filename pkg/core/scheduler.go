@@ -0,0 +1,145 @@
+package core
+
+import (
+	"errors"
+	"time"
+
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// errScheduleDone is returned when another node has already reset or downgraded the user
+var errScheduleDone = errors.New("already done by another node")
+
+// RunSchedule resets the traffic of the users at the end of each billing cycle,
+// and downgrades or disables the users whose plan has expired
+func (server *Server) RunSchedule() {
+	now := time.Now()
+	db := server.DB.DB
+	var users []model.User
+	err := db.Preload("Plan").
+		Where("disabled = ? AND plan_reset <= ?", false, now).
+		Where("plan_id IN (?)", db.Model(&model.Plan{}).Select("id").Where("cycle_days > 0")).
+		Find(&users).Error
+	if err != nil {
+		log.Error(err)
+	} else {
+		for _, user := range users {
+			server.resetTraffic(user, now)
+		}
+	}
+	users = nil
+	err = db.Preload("Plan").
+		Where("disabled = ? AND plan_end <= ?", false, now).
+		Where("plan_id IN (?)", db.Model(&model.Plan{}).Select("id").Where("duration_days > 0")).
+		Find(&users).Error
+	if err != nil {
+		log.Error(err)
+	} else {
+		for _, user := range users {
+			server.expirePlan(user, now)
+		}
+	}
+}
+
+func (server *Server) resetTraffic(user model.User, now time.Time) {
+	next := user.PlanReset
+	for !next.After(now) {
+		next = user.Plan.NextReset(next)
+	}
+	err := server.DB.DB.Transaction(func(tx *gorm.DB) error {
+		//the condition on plan_reset keeps other nodes from resetting the same cycle again
+		result := tx.Model(&model.User{}).
+			Where("id = ? AND plan_reset = ?", user.ID, user.PlanReset).
+			Updates(map[string]interface{}{
+				"traffic_used": 0,
+				"plan_reset":   next,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errScheduleDone
+		}
+		return tx.Create(&model.TrafficReset{
+			UserID:      user.ID,
+			PlanID:      user.PlanID,
+			TrafficUsed: user.TrafficUsed,
+			Reason:      model.ResetReasonCycle,
+		}).Error
+	})
+	if errors.Is(err, errScheduleDone) {
+		log.WithField("username", user.Username).Debug(err)
+		return
+	}
+	if err != nil {
+		log.WithField("username", user.Username).Error(err)
+		return
+	}
+	log.WithFields(log.Fields{
+		"username":   user.Username,
+		"plan":       user.Plan.Name,
+		"used":       user.TrafficUsed,
+		"next_reset": next,
+	}).Info("traffic reset")
+}
+
+func (server *Server) expirePlan(user model.User, now time.Time) {
+	fields := log.Fields{
+		"username": user.Username,
+		"plan":     user.Plan.Name,
+		"plan_end": user.PlanEnd,
+	}
+	if user.Plan.ExpiredPlanID == 0 {
+		err := server.DB.DB.Model(&model.User{}).Where("id = ?", user.ID).Update("disabled", true).Error
+		if err != nil {
+			log.WithFields(fields).Error(err)
+			return
+		}
+		server.tunnels.KillUser(user.Username, model.CloseReasonExpired)
+		log.WithFields(fields).Info("plan expired, user disabled")
+		return
+	}
+	plan := model.Plan{}
+	err := server.DB.DB.First(&plan, user.Plan.ExpiredPlanID).Error
+	if err != nil {
+		log.WithFields(fields).WithField("expired_plan_id", user.Plan.ExpiredPlanID).Error(err)
+		return
+	}
+	downgraded := user
+	downgraded.StartPlan(plan, now)
+	err = server.DB.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.User{}).
+			Where("id = ? AND plan_id = ? AND plan_end = ?", user.ID, user.PlanID, user.PlanEnd).
+			Updates(map[string]interface{}{
+				"plan_id":      downgraded.PlanID,
+				"traffic_used": downgraded.TrafficUsed,
+				"plan_start":   downgraded.PlanStart,
+				"plan_reset":   downgraded.PlanReset,
+				"plan_end":     downgraded.PlanEnd,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errScheduleDone
+		}
+		return tx.Create(&model.TrafficReset{
+			UserID:      user.ID,
+			PlanID:      user.PlanID,
+			TrafficUsed: user.TrafficUsed,
+			Reason:      model.ResetReasonExpire,
+		}).Error
+	})
+	if errors.Is(err, errScheduleDone) {
+		log.WithFields(fields).Debug(err)
+		return
+	}
+	if err != nil {
+		log.WithFields(fields).Error(err)
+		return
+	}
+	server.RefreshBucket(user.Username)
+	log.WithFields(fields).WithField("new_plan", plan.Name).Info("plan expired, user downgraded")
+}
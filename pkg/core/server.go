@@ -3,14 +3,12 @@ package core
 import (
 	"compress/flate"
 	"context"
-	"crypto/rand"
-	"crypto/sha512"
+	"crypto/tls"
 	"encoding/base64"
-	"encoding/binary"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,10 +16,10 @@ import (
 	"github.com/fasthttp/websocket"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
 	"github.com/iyouport-org/relaybaton/internal/memsocket"
+	"github.com/iyouport-org/relaybaton/internal/proxyproto"
 	"github.com/iyouport-org/relaybaton/pkg/config"
 	"github.com/iyouport-org/relaybaton/pkg/model"
 	"github.com/iyouport-org/relaybaton/pkg/socks5"
@@ -33,13 +31,24 @@ import (
 	"gorm.io/gorm/clause"
 )
 
+const bucketIdleTimeout = 10 * time.Minute
+
 type Server struct {
 	fx.Lifecycle
 	net.Listener
 	*config.ConfigGo
 	*hashmap.Map
-	mutex sync.RWMutex
-	ms    *memsocket.MemSocket
+	mutex         sync.RWMutex
+	ms            *memsocket.MemSocket
+	pretendFS     fasthttp.RequestHandler
+	pretendClient *fasthttp.Client
+	httpServer    *fasthttp.Server //serves the tunnel listeners, its worker pool is reported by the metrics
+	tunnels       *TunnelMap
+	metrics       *Metrics
+	acl           *ACL
+	node          *NodeState
+	rejected      map[string]string //stored runtime settings which failed to apply, only used by syncSettings
+	done          chan struct{}
 }
 
 func NewServer(lc fx.Lifecycle, conf *config.ConfigGo) *Server {
@@ -48,7 +57,14 @@ func NewServer(lc fx.Lifecycle, conf *config.ConfigGo) *Server {
 		ConfigGo:  conf,
 		Map:       hashmap.New(),
 		ms:        memsocket.NewMemSocket(),
+		tunnels:   NewTunnelMap(),
+		node:      NewNodeState(),
+		done:      make(chan struct{}),
+	}
+	server.httpServer = &fasthttp.Server{
+		Handler: server.requestHandler,
 	}
+	server.metrics = NewMetrics(server)
 	server.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			log.Debug("server start")
@@ -56,6 +72,9 @@ func NewServer(lc fx.Lifecycle, conf *config.ConfigGo) *Server {
 		},
 		OnStop: func(ctx context.Context) error {
 			log.Debug("server shutdown")
+			close(server.done)
+			server.FlushTraffic()
+			server.deregisterNode()
 			return nil
 		},
 	})
@@ -66,111 +85,240 @@ func (server *Server) Run() {
 	gin.SetMode(gin.DebugMode)
 	gin.DefaultErrorWriter = log.StandardLogger().WriterLevel(log.ErrorLevel)
 	gin.DefaultWriter = log.StandardLogger().Writer()
-	sessionTime := make([]byte, 8)
-	sessionRandom := make([]byte, 16)
-	authKey := make([]byte, 64)
-	cryptKey := make([]byte, 32)
-	n, err := rand.Read(authKey)
-	if err != nil {
-		log.Error(err)
-		return
-	}
-	if n != 64 {
-		err = errors.New("auth key not generated")
-		log.WithField("n", n).Error(err)
-		return
-	}
-	n, err = rand.Read(cryptKey)
-	if err != nil {
-		log.Error(err)
-		return
-	}
-	if n != 32 {
-		err = errors.New("crypt key not generated")
-		log.WithField("n", n).Error(err)
-		return
-	}
-	n, err = rand.Read(sessionRandom)
+	store, err := server.newSessionStore()
 	if err != nil {
-		log.Error(err)
-		return
+		log.Fatalf("error in loading session keys: %s", err)
 	}
-	if n != 16 {
-		err = errors.New("sessionName key not generated")
-		log.WithField("n", n).Error(err)
-		return
-	}
-	binary.BigEndian.PutUint64(sessionTime, uint64(time.Now().UnixNano()))
 
 	r := gin.Default()
+	if server.ConfigGo.Server().AdminSeparated() {
+		r.ForwardedByClientIP = false
+		r.Use(server.AllowAdmin)
+	}
 	r.LoadHTMLFiles("web/index.html")
-	r.Use(static.Serve("/", static.LocalFile("./web", false)))
-	r.Use(sessions.Sessions(hex.EncodeToString(sha512.New512_256().Sum(append(sessionTime, sessionRandom...))), cookie.NewStore(authKey, cryptKey)))
+	r.Use(static.Serve(server.ConfigGo.Server().AdminPath, static.LocalFile("./web", false)))
+	r.Use(server.withClientIP)
+	r.Use(sessions.Sessions(sessionName, store))
 	r.Use(gzip.Gzip(gzip.BestCompression))
-	r.GET("/", server.ServeRoot)
-	r.GET("/captcha/:hash", server.GetCaptcha)
-
-	r.POST("/user", server.PostUser)
-	r.DELETE("/user/:id", server.DeleteUser)
-	r.PUT("/user/:id", server.PutUser)
-	r.GET("/user", server.GetUser)
-	r.GET("/user/:id", server.GetUserOne)
-
-	r.POST("/session", server.PostSession)
-	r.DELETE("/session", server.DeleteSession)
-	r.PUT("/session", server.PutSession)
-	r.GET("/session", server.GetSession)
-
-	r.POST("/log", server.PostLog)
-	r.DELETE("/log/:id", server.DeleteLog)
-	r.PUT("/log/:id", server.PutLog)
-	r.GET("/log/:id", server.GetLogOne)
-	r.GET("/log", server.GetLogList)
-
-	r.POST("/config", server.PostConfig)
-	r.DELETE("/config", server.DeleteConfig)
-	r.PUT("/config", server.PutConfig)
-	r.GET("/config", server.GetConfig)
-
-	r.POST("/plan", server.PostPlan)
-	r.DELETE("/plan/:id", server.DeletePlan)
-	r.PUT("/plan/:id", server.PutPlan)
-	r.GET("/plan/:id", server.GetPlanOne)
-	r.GET("/plan", server.GetPlan)
-
-	r.POST("/meta", server.PostMeta)
-	r.DELETE("/meta", server.DeleteMeta)
-	r.PUT("/meta/undefined", server.PutMeta)
-	r.GET("/meta/undefined", server.GetMeta)
-
-	r.POST("/notice", server.PostNotice)
-	r.DELETE("/notice/:id", server.DeleteNotice)
-	r.PUT("/notice/:id", server.PutNotice)
-	r.GET("/notice/:id", server.GetNoticeOne)
-	r.GET("/notice", server.GetNotice)
+	api := r.Group(server.ConfigGo.Server().AdminPath)
+	api.GET("/", server.ServeRoot)
+	api.GET("/captcha/:hash", server.GetCaptcha)
+
+	api.POST("/user", server.PostUser)
+	api.DELETE("/user/:id", server.DeleteUser)
+	api.PUT("/user/:id", server.PutUser)
+	api.GET("/user", server.GetUser)
+	api.GET("/user/:id", server.GetUserOne)
+	api.PUT("/user/:id/password", server.PutUserPassword)
+	api.POST("/user/:id/password_reset", server.PostPasswordReset)
+	api.PUT("/password_reset", server.PutPasswordReset)
+
+	api.POST("/session", server.PostSession)
+	api.DELETE("/session", server.DeleteSession)
+	api.PUT("/session", server.PutSession)
+	api.GET("/session", server.GetSession)
+	api.GET("/session/active", server.GetActiveSession)
+	api.DELETE("/session/active", server.DeleteActiveSession)
+	api.DELETE("/session/active/:id", server.DeleteActiveSessionOne)
+	api.GET("/session/web", server.GetWebSession)
+	api.DELETE("/session/web", server.DeleteWebSession)
+	api.DELETE("/session/web/:id", server.DeleteWebSessionOne)
+
+	api.POST("/log", server.PostLog)
+	api.DELETE("/log", server.DeleteLogList)
+	api.DELETE("/log/:id", server.DeleteLog)
+	api.PUT("/log/:id", server.PutLog)
+	api.GET("/log/:id", server.GetLogOne)
+	api.GET("/log", server.GetLogList)
 
+	api.POST("/config", server.PostConfig)
+	api.DELETE("/config", server.DeleteConfig)
+	api.PUT("/config", server.PutConfig)
+	api.GET("/config", server.GetConfig)
+
+	api.POST("/plan", server.PostPlan)
+	api.DELETE("/plan/:id", server.DeletePlan)
+	api.PUT("/plan/:id", server.PutPlan)
+	api.GET("/plan/:id", server.GetPlanOne)
+	api.GET("/plan", server.GetPlan)
+
+	api.POST("/meta", server.PostMeta)
+	api.DELETE("/meta", server.DeleteMeta)
+	api.PUT("/meta/undefined", server.PutMeta)
+	api.GET("/meta/undefined", server.GetMeta)
+
+	api.POST("/notice", server.PostNotice)
+	api.DELETE("/notice/:id", server.DeleteNotice)
+	api.PUT("/notice/:id", server.PutNotice)
+	api.GET("/notice/:id", server.GetNoticeOne)
+	api.GET("/notice", server.GetNotice)
+
+	api.GET("/connection", server.GetConnection)
+
+	api.GET("/node", server.GetNode)
+	api.GET("/node/:id", server.GetNodeOne)
+	api.PUT("/node/:id", server.PutNode)
+	api.DELETE("/node/:id", server.DeleteNode)
+
+	api.POST("/token", server.PostAPIToken)
+	api.DELETE("/token/:id", server.DeleteAPIToken)
+	api.GET("/token", server.GetAPIToken)
+
+	api.GET("/metrics", server.ServeMetrics)
+
+	var adminLn net.Listener = server.ms.Listener()
+	if server.ConfigGo.Server().AdminSeparated() {
+		adminLn, err = server.listenAdmin()
+		if err != nil {
+			log.Fatalf("error in admin listener: %s", err)
+		}
+	}
 	go func() {
-		err := r.RunListener(server.ms.Listener())
+		err := r.RunListener(adminLn)
 		if err != nil {
 			log.Error(err)
 		}
 	}()
-	ln, err := reuseport.Listen("tcp4", ":80")
+	settings, err := server.loadSettings(server.DB.DB)
+	if err == nil {
+		err = server.ConfigGo.ApplySettings(settings)
+	}
+	if err != nil {
+		log.WithField("settings", settings).Errorf("error in applying runtime settings: %s", err)
+	}
+	server.acl, err = NewACL(server.ConfigGo)
+	if err != nil {
+		log.Fatalf("error in loading ACL: %s", err)
+	}
+	defer func() {
+		server.getACL().Close()
+	}()
+	err = server.registerNode()
 	if err != nil {
-		log.Fatal("error in reuseport listener: %s", err)
+		log.Fatalf("error in registering node: %s", err)
+	}
+	server.newPretendHandler()
+	serverConf := server.ConfigGo.Server()
+	go server.every(serverConf.TrafficFlushInterval, server.FlushTraffic)
+	go server.every(serverConf.ScheduleInterval, server.RunSchedule)
+	go server.every(bucketIdleTimeout, server.evictBuckets)
+	go server.every(time.Hour, server.purgeConnections)
+	go server.every(time.Hour, server.purgeLogs)
+	go server.every(serverConf.HeartbeatInterval, server.heartbeat)
+	go server.every(serverConf.HeartbeatInterval, server.syncSettings)
+	if serverConf.SessionStore == config.SessionStoreDB {
+		go server.every(time.Hour, server.purgeSessions)
+	}
+	if serverConf.TLS != nil {
+		go server.serveTLS()
+	}
+	ln, err := server.listen(serverConf.Port)
+	if err != nil {
+		log.Fatalf("error in reuseport listener: %s", err)
 	}
 	defer ln.Close()
-	if err = fasthttp.Serve(ln, server.requestHandler); err != nil {
-		log.Fatal("error in fasthttp Server: %s", err)
+	if err = server.httpServer.Serve(ln); err != nil {
+		log.Fatalf("error in fasthttp Server: %s", err)
 	}
+}
+
+func (server *Server) serveTLS() {
+	tlsConf := server.ConfigGo.Server().TLS
+	reloader, err := NewCertReloader(tlsConf.CertFile, tlsConf.KeyFile)
+	if err != nil {
+		log.Fatalf("error in loading certificate: %s", err)
+	}
+	defer reloader.Close()
+	ln, err := server.listen(tlsConf.Port)
+	if err != nil {
+		log.Fatalf("error in reuseport listener: %s", err)
+	}
+	tlsLn := tls.NewListener(ln, &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	})
+	defer tlsLn.Close()
+	if err = server.httpServer.Serve(tlsLn); err != nil {
+		log.Fatalf("error in fasthttp TLS Server: %s", err)
+	}
+}
+
+// ApplyConfig picks up the settings changed by a configuration reload
+func (server *Server) ApplyConfig() {
+	acl, err := NewACL(server.ConfigGo)
 	if err != nil {
 		log.Error(err)
+		return
+	}
+	server.mutex.Lock()
+	old := server.acl
+	server.acl = acl
+	server.mutex.Unlock()
+	if old != nil {
+		//tunnels being opened may still use the old GeoIP database
+		time.AfterFunc(time.Minute, func() {
+			old.Close()
+		})
+	}
+	server.mutex.RLock()
+	usernames := server.Map.Keys()
+	server.mutex.RUnlock()
+	for _, username := range usernames {
+		server.RefreshBucket(username.(string))
+	}
+}
+
+func (server *Server) getACL() *ACL {
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+	return server.acl
+}
+
+// every runs task periodically until the server shuts down
+func (server *Server) every(interval time.Duration, task func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			task()
+		case <-server.done:
+			return
+		}
 	}
 }
 
+func (server *Server) listen(port uint16) (net.Listener, error) {
+	ln, err := reuseport.Listen("tcp4", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+	if server.ConfigGo.Server().ProxyProtocol {
+		return proxyproto.NewListener(ln), nil
+	}
+	return ln, nil
+}
+
 func (server *Server) requestHandler(ctx *fasthttp.RequestCtx) {
+	clientIP := server.ClientIP(ctx)
 	if !server.Authenticate(ctx) {
-		server.serveWeb(ctx)
+		if ctx.Request.Header.Peek("username") != nil {
+			log.WithFields(log.Fields{
+				"client_ip": clientIP.String(),
+				"username":  string(ctx.Request.Header.Peek("username")),
+			}).Warn("authentication failed")
+		}
+		server.serveFallback(ctx)
+		return
+	}
+	user := ctx.UserValue("user").(*model.User)
+	if !server.node.Accepting() {
+		log.WithFields(log.Fields{
+			"client_ip": clientIP.String(),
+			"username":  user.Username,
+		}).Warn("node not accepting tunnels")
+		server.metrics.tunnelFailures.WithLabelValues(failureNode).Inc()
+		server.reject(ctx, fasthttp.StatusServiceUnavailable, socks5.RepServerFailure)
 		return
 	}
 	var upgrader = websocket.FastHTTPUpgrader{
@@ -179,114 +327,216 @@ func (server *Server) requestHandler(ctx *fasthttp.RequestCtx) {
 	tcpAddr, err := net.ResolveTCPAddr("tcp", string(ctx.Request.Header.Peek("addr")))
 	if err != nil {
 		log.Error(err)
+		server.metrics.tunnelFailures.WithLabelValues(failureBadRequest).Inc()
 		return
 	}
+	username := ctx.Request.Header.Peek("username")
+	domain := string(ctx.Request.Header.Peek("domain"))
+	if domain != "" && server.getACL().HasDomainRules() {
+		tcpAddr, err = pinDestination(domain, tcpAddr)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"client_ip": clientIP.String(),
+				"username":  string(username),
+			}).Warn(err)
+			server.metrics.tunnelFailures.WithLabelValues(failureDial).Inc()
+			server.reject(ctx, fasthttp.StatusBadGateway, socks5.RepHostUnreachable)
+			return
+		}
+	}
 	ip := tcpAddr.IP
-	if ip.To4() == nil {
-		ip = ip.To4()
-	} else {
-		ip = ip.To16()
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	fields := log.Fields{
+		"client_ip": clientIP.String(),
+		"username":  string(username),
+	}
+	if !server.ConfigGo.Server().HideDestination {
+		fields["addr"] = tcpAddr.String()
+		if domain != "" {
+			fields["domain"] = domain
+		}
 	}
 	if isReservedIP(ip) {
 		err := errors.New("reserved")
-		log.WithField("ip", ip.String()).Error(err)
+		log.WithFields(fields).Error(err)
+		server.metrics.tunnelFailures.WithLabelValues(failureReserved).Inc()
+		server.reject(ctx, fasthttp.StatusForbidden, socks5.RepConnectionNotAllowedByRuleset)
 		return
 	}
-	c, err := net.Dial("tcp", string(ctx.Request.Header.Peek("addr")))
+	if !server.getACL().Allow(ip, uint16(tcpAddr.Port), domain) {
+		log.WithFields(fields).Warn("destination denied by ACL")
+		server.metrics.tunnelFailures.WithLabelValues(failureACL).Inc()
+		server.reject(ctx, fasthttp.StatusForbidden, socks5.RepConnectionNotAllowedByRuleset)
+		return
+	}
+	category, err := server.checkPolicy(ctx, user.Plan, ip, uint16(tcpAddr.Port), domain)
 	if err != nil {
-		log.Error(err)
+		if category != "" {
+			fields["category"] = category
+		}
+		log.WithFields(fields).Warn(err)
+		server.metrics.tunnelFailures.WithLabelValues(failurePolicy).Inc()
+		server.reject(ctx, fasthttp.StatusForbidden, socks5.RepConnectionNotAllowedByRuleset)
+		return
+	}
+	tunnel := NewTunnel(user.ID, user.Username, clientIP, tcpAddr.String(), domain)
+	err = server.tunnels.Open(tunnel, user.Plan, server.node.Remote(user.Username))
+	if err != nil {
+		log.WithFields(fields).Warn(err)
+		server.metrics.tunnelFailures.WithLabelValues(failureLimit).Inc()
+		server.reject(ctx, fasthttp.StatusTooManyRequests, socks5.RepConnectionNotAllowedByRuleset)
+		return
+	}
+	c, err := net.Dial("tcp", tcpAddr.String())
+	if err != nil {
+		server.tunnels.Close(tunnel)
+		log.WithFields(fields).Error(err)
+		server.metrics.tunnelFailures.WithLabelValues(failureDial).Inc()
 		return
 	}
 	ctx.Response.Header.Add("reply", fmt.Sprintf("%d", socks5.RepSucceeded))
-	username := ctx.Request.Header.Peek("username")
 	err = upgrader.Upgrade(ctx, func(conn *websocket.Conn) {
-		err = conn.SetCompressionLevel(flate.BestCompression)
+		tunnel.Bind(func() {
+			conn.Close()
+			c.Close()
+		})
+		defer server.tunnels.Close(tunnel)
+		err := conn.SetCompressionLevel(flate.BestCompression)
 		if err != nil {
 			log.Error(err)
-			conn.Close()
+			tunnel.KillWith(model.CloseReasonError)
+			return
+		}
+		log.WithFields(fields).Info("tunnel opened")
+		server.metrics.tunnelOpens.Inc()
+		if user.Plan.MaxDuration > 0 {
+			timer := time.AfterFunc(time.Duration(user.Plan.MaxDuration)*time.Second, func() {
+				tunnel.KillWith(model.CloseReasonMaxDuration)
+			})
+			defer timer.Stop()
+		}
+		defer func() {
+			fields["up"] = tunnel.Up()
+			fields["down"] = tunnel.Down()
+			fields["reason"] = tunnel.Reason()
+			log.WithFields(fields).Info("tunnel closed")
+			server.recordConnection(tunnel)
+		}()
+		bucket, err := server.GetBucket(user.Username)
+		if err != nil {
+			log.WithFields(fields).Error(err)
+			tunnel.KillWith(model.CloseReasonError)
 			return
 		}
 		var wg sync.WaitGroup
 		wg.Add(2)
-		bandwidth := 0
-		defer func(username string) {
-			user, err := server.getUser(username)
-			if err != nil {
-				log.Error(err)
-				return
-			}
-			user.TrafficUsed += uint(bandwidth)
-			db := server.DB.DB
-			db.Save(user)
-		}(string(username))
-		go func(username string) {
+		go func() {
+			defer wg.Done()
+			defer tunnel.Kill()
+			b := make([]byte, 1<<15)
 			for {
-				bucket, err := server.GetBucket(username)
-				if err != nil {
-					log.Error(err)
-					wg.Done()
-					return
-				}
-				readLen := bucket.Available()
-				if readLen == 0 {
-					readLen = uint64(bucket.bandwidth)
-				}
-				b := make([]byte, readLen)
 				n, err := c.Read(b)
 				if err != nil {
 					log.Error(err)
-					wg.Done()
+					tunnel.KillWith(model.CloseReasonDestination)
 					return
 				}
-				err = bucket.Wait(uint(n))
+				err = server.wait(bucket, tunnel, n)
 				if err != nil {
 					log.Error(err)
-					wg.Done()
 					return
 				}
-				bandwidth += n
+				tunnel.AddDown(n)
+				server.node.traffic.AddDown(n)
+				server.metrics.tunnelBytes.WithLabelValues("down").Add(float64(n))
 				err = conn.WriteMessage(websocket.BinaryMessage, b[:n])
 				if err != nil {
 					log.Error(err)
-					wg.Done()
+					tunnel.KillWith(model.CloseReasonClient)
 					return
 				}
 			}
-		}(string(username))
-		go func(username string) {
+		}()
+		go func() {
+			defer wg.Done()
+			defer tunnel.Kill()
 			for {
 				_, b, err := conn.ReadMessage()
 				if err != nil {
 					log.Error(err)
-					wg.Done()
+					tunnel.KillWith(model.CloseReasonClient)
 					return
 				}
-				bandwidth += len(b)
+				err = server.wait(bucket, tunnel, len(b))
+				if err != nil {
+					log.Error(err)
+					return
+				}
+				tunnel.AddUp(len(b))
+				server.node.traffic.AddUp(len(b))
+				server.metrics.tunnelBytes.WithLabelValues("up").Add(float64(len(b)))
 				_, err = c.Write(b)
 				if err != nil {
 					log.Error(err)
-					wg.Done()
+					tunnel.KillWith(model.CloseReasonDestination)
 					return
 				}
 			}
-		}(string(username))
+		}()
 		wg.Wait()
-		err := conn.Close()
-		if err != nil {
-			log.Error(err)
-		}
 	})
 	if err != nil {
-		server.serveWeb(ctx)
+		server.tunnels.Close(tunnel)
+		c.Close()
+		server.metrics.tunnelFailures.WithLabelValues(failureUpgrade).Inc()
+		server.serveFallback(ctx)
 		log.Println(err)
 		return
 	}
 }
 
-func (server *Server) Authenticate(ctx *fasthttp.RequestCtx) bool {
+// reject refuses to open the tunnel, rep is sent back to the client as the SOCKS5 reply
+// pinDestination returns addr if domain resolves to its IP, otherwise an address which domain resolves to,
+// so that the domain rules are checked on the address dialed rather than on the one claimed by the client
+func pinDestination(domain string, addr *net.TCPAddr) (*net.TCPAddr, error) {
+	ips, err := net.DefaultResolver.LookupIPAddr(context.Background(), domain)
+	if err != nil {
+		return nil, err
+	}
+	var pinned *net.TCPAddr
+	for _, ip := range ips {
+		if ip.IP.Equal(addr.IP) {
+			return addr, nil
+		}
+		if pinned == nil || (pinned.IP.To4() == nil && ip.IP.To4() != nil) {
+			pinned = &net.TCPAddr{
+				IP:   ip.IP,
+				Port: addr.Port,
+			}
+		}
+	}
+	if pinned == nil {
+		return nil, fmt.Errorf("no address found for %s", domain)
+	}
+	return pinned, nil
+}
+
+func (server *Server) reject(ctx *fasthttp.RequestCtx, statusCode int, rep socks5.Rep) {
+	ctx.Error(fasthttp.StatusMessage(statusCode), statusCode)
+	ctx.Response.Header.Set("reply", fmt.Sprintf("%d", rep))
+}
+
+func (server *Server) Authenticate(ctx *fasthttp.RequestCtx) (ok bool) {
 	if ctx.Request.Header.Peek("addr") == nil || ctx.Request.Header.Peek("username") == nil || ctx.Request.Header.Peek("password") == nil {
 		return false
 	}
+	defer func() {
+		if !ok {
+			server.metrics.authFailures.Inc()
+		}
+	}()
 	username := string(ctx.Request.Header.Peek("username"))
 	password := string(ctx.Request.Header.Peek("password"))
 	user, err := server.getUser(username)
@@ -295,8 +545,16 @@ func (server *Server) Authenticate(ctx *fasthttp.RequestCtx) bool {
 		return false
 	}
 	if username == "admin" {
-		return password == user.Password
+		if password != user.Password {
+			return false
+		}
+		ctx.SetUserValue("user", user)
+		return true
 	} else {
+		if user.Disabled {
+			log.WithField("username", username).Debug("user disabled")
+			return false
+		}
 		if user.Plan.TrafficLimit <= user.TrafficUsed {
 			log.WithFields(log.Fields{
 				"plan":  user.Plan.Name,
@@ -324,11 +582,42 @@ func (server *Server) Authenticate(ctx *fasthttp.RequestCtx) bool {
 			log.Error(err)
 			return false
 		}
+		ctx.SetUserValue("user", user)
 		return true
 	}
 }
 
+// ClientIP returns the real address of the client, taken from the forwarding headers if the peer is a trusted proxy
+func (server *Server) ClientIP(ctx *fasthttp.RequestCtx) net.IP {
+	if v, ok := ctx.UserValue("client_ip").(net.IP); ok {
+		return v
+	}
+	serverConf := server.ConfigGo.Server()
+	ip := ctx.RemoteIP()
+	if serverConf.TrustedProxy(ip) {
+		if cfIP := net.ParseIP(string(ctx.Request.Header.Peek("CF-Connecting-IP"))); cfIP != nil {
+			ip = cfIP
+		} else if xff := ctx.Request.Header.Peek(fasthttp.HeaderXForwardedFor); xff != nil {
+			//the rightmost address not belonging to a trusted proxy is the client
+			hops := strings.Split(string(xff), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop := net.ParseIP(strings.TrimSpace(hops[i]))
+				if hop == nil {
+					break
+				}
+				ip = hop
+				if !serverConf.TrustedProxy(hop) {
+					break
+				}
+			}
+		}
+	}
+	ctx.SetUserValue("client_ip", ip)
+	return ip
+}
+
 func (server *Server) getUser(username string) (*model.User, error) {
+	defer server.observeQuery("get_user", time.Now())
 	db := server.DB.DB
 	user := &model.User{}
 	err := db.Preload(clause.Associations).Where("username = ?", username).First(user).Error
@@ -339,41 +628,43 @@ func (server *Server) getUser(username string) (*model.User, error) {
 	return user, err
 }
 
-/**
-func (server *Server) redirect(ctx *fasthttp.RequestCtx) {
-	newReq := fasthttp.AcquireRequest()
-	ctx.Request.CopyTo(newReq)
-	newReq.SetHost(server.Server.Pretend.Host)
-	newReq.SetRequestURI(server.Server.Pretend.String() + string(ctx.Request.RequestURI()))
-	newReq.WriteTo(log.StandardLogger().Writer())
-	rep := fasthttp.AcquireResponse()
-	err := fasthttp.Do(newReq, rep)
-	newReq.Header.Header()
-	rep.CopyTo(&ctx.Response)
-	if err != nil {
-		log.Error(err)
-		return
+// wait blocks the tunnel until the rate limiter lets n bytes pass
+func (server *Server) wait(bucket *RateLimiter, tunnel *Tunnel, n int) error {
+	start := time.Now()
+	err := bucket.WaitN(tunnel.Context(), n)
+	if elapsed := time.Since(start); elapsed > time.Millisecond {
+		server.metrics.rateLimiterWait.Add(elapsed.Seconds())
 	}
+	return err
 }
-**/
 
+// GetBucket returns the rate limiter shared by all the tunnels of the user
 func (server *Server) GetBucket(username string) (*RateLimiter, error) {
 	server.mutex.RLock()
 	v, ok := server.Map.Get(username)
 	server.mutex.RUnlock()
-	if !ok {
+	if ok {
+		server.metrics.bucketLookups.WithLabelValues("hit").Inc()
+	} else {
+		server.metrics.bucketLookups.WithLabelValues("miss").Inc()
 		user, err := server.getUser(username)
 		if err != nil {
 			log.WithField("username", username).Error(err)
 			return nil, err
 		}
-		log.WithField("limit", user.Plan.BandwidthLimit).Debug("bandwidth limit")
-		bucket := NewRateLimiter(user.Plan.BandwidthLimit / 2)
 		server.mutex.Lock()
-		server.Map.Put(username, bucket)
-		server.mutex.Unlock()
-		log.Debug("bucket saved")
-		return bucket, nil
+		defer server.mutex.Unlock()
+		//another tunnel of the user may have created it in the meantime
+		v, ok = server.Map.Get(username)
+		if !ok {
+			log.WithFields(log.Fields{
+				"username": username,
+				"limit":    user.Plan.BandwidthLimit,
+			}).Debug("bucket created")
+			bucket := NewRateLimiter(user.Plan.BandwidthLimit)
+			server.Map.Put(username, bucket)
+			return bucket, nil
+		}
 	}
 	bucket, ok := v.(*RateLimiter)
 	if !ok {
@@ -383,3 +674,49 @@ func (server *Server) GetBucket(username string) (*RateLimiter, error) {
 	}
 	return bucket, nil
 }
+
+// RefreshBucket applies the current plan of the user to its rate limiter
+func (server *Server) RefreshBucket(username string) {
+	server.mutex.RLock()
+	v, ok := server.Map.Get(username)
+	server.mutex.RUnlock()
+	if !ok {
+		return
+	}
+	user, err := server.getUser(username)
+	if err != nil {
+		log.WithField("username", username).Error(err)
+		return
+	}
+	v.(*RateLimiter).SetBandwidth(user.Plan.BandwidthLimit)
+	log.WithFields(log.Fields{
+		"username": username,
+		"limit":    user.Plan.BandwidthLimit,
+	}).Debug("bucket updated")
+}
+
+// RefreshPlanBuckets applies the plan to the rate limiters of all its users
+func (server *Server) RefreshPlanBuckets(planID uint) {
+	var usernames []string
+	err := server.DB.DB.Model(&model.User{}).Where("plan_id = ?", planID).Pluck("username", &usernames).Error
+	if err != nil {
+		log.WithField("plan_id", planID).Error(err)
+		return
+	}
+	for _, username := range usernames {
+		server.RefreshBucket(username)
+	}
+}
+
+// evictBuckets removes the rate limiters of the users without tunnels which have been idle for a while
+func (server *Server) evictBuckets() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	for _, k := range server.Map.Keys() {
+		v, _ := server.Map.Get(k)
+		username := k.(string)
+		if time.Since(v.(*RateLimiter).IdleSince()) > bucketIdleTimeout && !server.tunnels.HasUser(username) {
+			server.Map.Remove(k)
+		}
+	}
+}
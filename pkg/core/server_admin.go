@@ -0,0 +1,63 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+// listenAdmin opens the dedicated listener of the admin web API
+func (server *Server) listenAdmin() (net.Listener, error) {
+	serverConf := server.ConfigGo.Server()
+	network := serverConf.AdminNetwork
+	addr := serverConf.AdminAddr
+	if network == "unix" {
+		err := os.Remove(addr)
+		if err != nil && !os.IsNotExist(err) {
+			log.WithField("addr", addr).Error(err)
+			return nil, err
+		}
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"network": network,
+			"addr":    addr,
+		}).Error(err)
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"network": network,
+		"addr":    addr,
+	}).Info("admin web API listening")
+	return ln, nil
+}
+
+// AllowAdmin rejects admin web API requests from addresses outside server.admin_allow
+func (server *Server) AllowAdmin(c *gin.Context) {
+	serverConf := server.ConfigGo.Server()
+	allow := serverConf.AdminAllow
+	if len(allow) == 0 || serverConf.AdminNetwork == "unix" {
+		c.Next()
+		return
+	}
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		log.WithField("remote_addr", c.Request.RemoteAddr).Error(err)
+		c.AbortWithStatus(fasthttp.StatusForbidden)
+		return
+	}
+	ip := net.ParseIP(host)
+	for _, block := range allow {
+		if ip != nil && block.Contains(ip) {
+			c.Next()
+			return
+		}
+	}
+	log.WithField("remote_addr", c.Request.RemoteAddr).Warn(errors.New("admin web API access denied"))
+	c.AbortWithStatus(fasthttp.StatusForbidden)
+}
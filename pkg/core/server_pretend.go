@@ -0,0 +1,93 @@
+package core
+
+import (
+	"bytes"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+// serveFallback handles requests that are not authenticated as tunnels
+func (server *Server) serveFallback(ctx *fasthttp.RequestCtx) {
+	if server.isAdminPath(ctx.Path()) {
+		server.serveWeb(ctx)
+		return
+	}
+	serverConf := server.ConfigGo.Server()
+	switch {
+	case serverConf.Pretend != nil:
+		server.redirect(ctx)
+	case server.pretendFS != nil:
+		server.pretendFS(ctx)
+	case serverConf.AdminSeparated():
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+	default:
+		server.serveWeb(ctx)
+	}
+}
+
+func (server *Server) isAdminPath(path []byte) bool {
+	serverConf := server.ConfigGo.Server()
+	if serverConf.AdminSeparated() {
+		return false
+	}
+	adminPath := serverConf.AdminPath
+	if adminPath == "/" {
+		return !serverConf.Camouflaged()
+	}
+	return bytes.Equal(path, []byte(adminPath)) || bytes.HasPrefix(path, []byte(adminPath+"/"))
+}
+
+func (server *Server) newPretendHandler() {
+	serverConf := server.ConfigGo.Server()
+	if serverConf.PretendDir != "" {
+		fs := &fasthttp.FS{
+			Root:               serverConf.PretendDir,
+			IndexNames:         []string{"index.html"},
+			GenerateIndexPages: false,
+			Compress:           true,
+		}
+		server.pretendFS = fs.NewRequestHandler()
+	}
+	if serverConf.Pretend != nil {
+		server.pretendClient = &fasthttp.Client{
+			NoDefaultUserAgentHeader: true,
+			ReadTimeout:              30 * time.Second,
+			WriteTimeout:             30 * time.Second,
+			MaxIdleConnDuration:      time.Minute,
+		}
+	}
+}
+
+// redirect reverse proxies the request to the pretend site
+func (server *Server) redirect(ctx *fasthttp.RequestCtx) {
+	pretend := server.ConfigGo.Server().Pretend
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	ctx.Request.CopyTo(req)
+	for _, header := range []string{"addr", "domain", "username", "password", "network", "cmd", "Connection", "Upgrade", "Proxy-Connection", "Keep-Alive", "Te", "Trailer", "Transfer-Encoding"} {
+		req.Header.Del(header)
+	}
+	req.URI().SetScheme(pretend.Scheme)
+	req.URI().SetHost(pretend.Host)
+	req.SetHost(pretend.Host)
+	err := server.pretendClient.Do(req, &ctx.Response)
+	if err != nil {
+		log.WithField("pretend", pretend.String()).Error(err)
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusBadGateway), fasthttp.StatusBadGateway)
+		return
+	}
+	//keep the visitor on this domain when the pretend site redirects to itself
+	location := ctx.Response.Header.Peek(fasthttp.HeaderLocation)
+	if len(location) > 0 {
+		uri := fasthttp.AcquireURI()
+		defer fasthttp.ReleaseURI(uri)
+		if uri.Parse(nil, location) == nil && string(uri.Host()) == pretend.Host {
+			ctx.Response.Header.SetBytesV(fasthttp.HeaderLocation, uri.RequestURI())
+		}
+	}
+	for _, header := range []string{"Connection", "Keep-Alive", "Transfer-Encoding"} {
+		ctx.Response.Header.Del(header)
+	}
+}
@@ -4,14 +4,18 @@ import (
 	"bufio"
 	"crypto/sha512"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dchest/captcha"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/iyouport-org/relaybaton/pkg/config"
 	"github.com/iyouport-org/relaybaton/pkg/model"
+	"github.com/iyouport-org/relaybaton/pkg/util"
 	"github.com/iyouport-org/relaybaton/pkg/webapi"
 	log "github.com/sirupsen/logrus"
 	"github.com/valyala/fasthttp"
@@ -20,6 +24,9 @@ import (
 )
 
 func (server *Server) serveWeb(ctx *fasthttp.RequestCtx) {
+	clientIP := server.ClientIP(ctx).String()
+	ctx.Request.Header.Set(fasthttp.HeaderXForwardedFor, clientIP)
+	ctx.Request.Header.Set("X-Real-IP", clientIP)
 	memconn := server.ms.Dial()
 	_, err := ctx.Request.WriteTo(memconn)
 	if err != nil {
@@ -73,6 +80,13 @@ func (server *Server) PostUser(c *gin.Context) {
 		})
 		return
 	}
+	if !server.ConfigGo.Server().RegistrationOpen {
+		c.JSON(fasthttp.StatusForbidden, &webapi.PostUserResponse{
+			OK:       false,
+			ErrorMsg: "Registration closed",
+		})
+		return
+	}
 	captchaID := session.Get("captchaID")
 	if captchaID != nil {
 		if captcha.VerifyString(captchaID.(string), request.Captcha) {
@@ -95,16 +109,19 @@ func (server *Server) PostUser(c *gin.Context) {
 				c.AbortWithError(fasthttp.StatusInternalServerError, err)
 				return
 			}
-			err = server.DB.DB.Create(&model.User{
-				Username:    request.Username,
-				Password:    base64.StdEncoding.EncodeToString(cryptKey),
-				PlanID:      1,
-				TrafficUsed: 0,
-				PlanID:      1,
-				PlanStart:   time.Now(),
-				PlanReset:   time.Now(),
-				PlanEnd:     time.Now(),
-			}).Error
+			plan := model.Plan{}
+			err = server.DB.DB.First(&plan, server.ConfigGo.Server().DefaultPlan).Error
+			if err != nil {
+				log.Error(err)
+				c.AbortWithError(fasthttp.StatusInternalServerError, err)
+				return
+			}
+			user := &model.User{
+				Username: request.Username,
+				Password: base64.StdEncoding.EncodeToString(cryptKey),
+			}
+			user.StartPlan(plan, time.Now())
+			err = server.DB.DB.Omit("Plan").Create(user).Error
 			if err != nil {
 				log.Error(err)
 				if err.Error() == "UNIQUE constraint failed: users.username" {
@@ -166,83 +183,76 @@ func (server *Server) DeleteUser(c *gin.Context) {
 }
 
 func (server *Server) PutUser(c *gin.Context) {
-	request := &webapi.User{}
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
-	if err == nil {
-		err = c.BindJSON(request)
-
-		if err == nil {
-			log.Debug(request)
-			result := server.DB.DB.Model(&model.User{
-				Model: gorm.Model{
-					ID: uint(id),
-				},
-			}).Updates(map[string]interface{}{
-				"username":     request.Username,
-				"role":         request.Role,
-				"plan_id":      request.PlanID,
-				"traffic_used": request.TrafficUsed,
-				"plan_start":   request.PlanStart,
-				"plan_reset":   request.PlanReset,
-				"plan_end":     request.PlanEnd,
-			})
-			if result.Error != nil {
-				log.Error(result.Error)
-				c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		request := &webapi.User{}
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 64)
+		if err == nil {
+			err = c.BindJSON(request)
+
+			if err == nil {
+				log.Debug(request)
+				result := server.DB.DB.Model(&model.User{
+					Model: gorm.Model{
+						ID: uint(id),
+					},
+				}).Updates(map[string]interface{}{
+					"username":     request.Username,
+					"role":         request.Role,
+					"plan_id":      request.PlanID,
+					"traffic_used": request.TrafficUsed,
+					"plan_start":   request.PlanStart,
+					"plan_reset":   request.PlanReset,
+					"plan_end":     request.PlanEnd,
+					"disabled":     request.Disabled,
+				})
+				if result.Error != nil {
+					log.Error(result.Error)
+					c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+				} else {
+					log.Debug(result.RowsAffected)
+					user := model.User{}
+					err = server.DB.DB.Select("username").First(&user, id).Error
+					if err == nil {
+						server.RefreshBucket(user.Username)
+					} else {
+						log.WithField("id", id).Error(err)
+					}
+					c.JSON(fasthttp.StatusOK, request)
+				}
 			} else {
-				log.Debug(result.RowsAffected)
-				c.JSON(fasthttp.StatusOK, request)
+				log.Error(err)
+				c.AbortWithError(fasthttp.StatusBadRequest, err)
 			}
 		} else {
 			log.Error(err)
 			c.AbortWithError(fasthttp.StatusBadRequest, err)
 		}
 	} else {
-		log.Error(err)
-		c.AbortWithError(fasthttp.StatusBadRequest, err)
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
 	}
 }
 
 func (server *Server) GetUser(c *gin.Context) {
-	session := sessions.Default(c)
 	_, ok := c.GetQuery("_start")
 	if !ok {
-		userID := session.Get("userID")
+		userID := server.sessionUserID(c)
 		if userID != nil {
 			if userID == "admin" {
-				c.JSON(fasthttp.StatusOK, &webapi.User{
-					ID:                 0,
-					Username:           "admin",
-					Role:               model.RoleAdmin,
-					PlanID:             0,
-					PlanName:           "",
-					PlanBandwidthLimit: 0,
-					PlanTrafficLimit:   0,
-					TrafficUsed:        0,
-					PlanStart:          time.Now(),
-					PlanReset:          time.Now(),
-					PlanEnd:            time.Now(),
-				})
+				c.JSON(fasthttp.StatusOK, webapi.GetAdminUser())
 			} else {
 				userIDUint, ok := userID.(uint)
 				if ok {
 					user := &model.User{}
-					result := server.DB.DB.First(user, userIDUint)
+					result := server.DB.DB.Preload("Plan").First(user, userIDUint)
 					if result.Error == nil {
-						c.JSON(fasthttp.StatusOK, &webapi.User{
-							ID:                 user.ID,
-							Username:           user.Username,
-							Role:               user.Role,
-							PlanID:             user.PlanID,
-							PlanName:           user.Plan.Name,
-							PlanBandwidthLimit: user.Plan.BandwidthLimit,
-							PlanTrafficLimit:   user.Plan.TrafficLimit,
-							TrafficUsed:        user.TrafficUsed,
-							PlanStart:          user.PlanStart,
-							PlanReset:          user.PlanReset,
-							PlanEnd:            user.PlanEnd,
-						})
+						c.JSON(fasthttp.StatusOK, webapi.GetUser(*user))
 						return
 					} else {
 						log.Error(result.Error)
@@ -273,7 +283,7 @@ func (server *Server) GetUserList(c *gin.Context) {
 		var modelUsers []model.User
 		var total int64
 		var contentRange int64
-		result := server.DB.DB.Where("id BETWEEN ? and ?", start, end).Order(fmt.Sprintf("%s %s", sort, order)).Find(&modelUsers).Count(&total)
+		result := server.DB.DB.Preload("Plan").Where("id BETWEEN ? and ?", start, end).Order(fmt.Sprintf("%s %s", sort, order)).Find(&modelUsers).Count(&total)
 		if result.Error == nil {
 			server.DB.DB.Table("users").Count(&contentRange)
 			c.Writer.Header().Set("X-Total-Count", strconv.FormatInt(contentRange, 10))
@@ -298,22 +308,10 @@ func (server *Server) GetUserOne(c *gin.Context) {
 		id, err := strconv.ParseUint(idStr, 10, 64)
 		if err == nil {
 			modelUser := &model.User{}
-			result := server.DB.DB.First(modelUser, id)
+			result := server.DB.DB.Preload("Plan").First(modelUser, id)
 			if result.Error == nil {
 				c.JSON(fasthttp.StatusOK,
-					&webapi.User{
-						ID:                 modelUser.ID,
-						Username:           modelUser.Username,
-						Role:               modelUser.Role,
-						PlanID:             modelUser.PlanID,
-						PlanName:           modelUser.Plan.Name,
-						PlanBandwidthLimit: modelUser.Plan.BandwidthLimit,
-						PlanTrafficLimit:   modelUser.Plan.TrafficLimit,
-						TrafficUsed:        modelUser.TrafficUsed,
-						PlanStart:          modelUser.PlanStart,
-						PlanReset:          modelUser.PlanReset,
-						PlanEnd:            modelUser.PlanEnd,
-					},
+					webapi.GetUser(*modelUser),
 				)
 			} else {
 				log.Error(err)
@@ -358,16 +356,18 @@ func (server *Server) PostSession(c *gin.Context) {
 		return
 	}
 	if request.Username == "admin" {
-		correctKey := sha512.Sum512([]byte(server.ConfigGo.Server.AdminPassword))
+		correctKey := sha512.Sum512([]byte(server.ConfigGo.Server().AdminPassword))
 		if string(correctKey[:]) == string(sha512key) {
-			session.Set("userID", "admin")
+			err = server.login(session, "admin")
 		} else {
 			log.WithFields(log.Fields{
+				"client_ip":            c.ClientIP(),
 				"password_in":          request.Password,
 				"password_in_sha512":   sha512key,
-				"real_password":        server.ConfigGo.Server.AdminPassword,
+				"real_password":        server.ConfigGo.Server().AdminPassword,
 				"real_password_sha512": correctKey[:],
 			}).Debug("admin login error")
+			err = session.Save()
 		}
 	} else {
 		user := model.User{}
@@ -386,16 +386,18 @@ func (server *Server) PostSession(c *gin.Context) {
 		}
 		err = bcrypt.CompareHashAndPassword(correctKey, sha512key)
 		if err != nil {
-			log.Error(err)
+			log.WithFields(log.Fields{
+				"client_ip": c.ClientIP(),
+				"username":  request.Username,
+			}).Error(err)
 			c.JSON(fasthttp.StatusForbidden, &webapi.PostSessionResponse{
 				OK:       false,
 				ErrorMsg: "Wrong password",
 			})
 			return
 		}
-		session.Set("userID", user.ID)
+		err = server.login(session, user.ID)
 	}
-	err = session.Save()
 	if err != nil {
 		log.Error(err)
 		c.AbortWithError(fasthttp.StatusInternalServerError, err)
@@ -407,16 +409,58 @@ func (server *Server) PostSession(c *gin.Context) {
 	})
 }
 
+//logout
 func (server *Server) DeleteSession(c *gin.Context) {
-
+	session := sessions.Default(c)
+	err := server.logout(session)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithError(fasthttp.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(fasthttp.StatusOK, &webapi.DeleteSessionResponse{
+		OK: true,
+	})
 }
 
+// PutSession refreshes the session of the logged in user, postponing its idle timeout
 func (server *Server) PutSession(c *gin.Context) {
-
+	session := sessions.Default(c)
+	userID := server.sessionUserID(c)
+	if userID == nil {
+		c.AbortWithStatusJSON(fasthttp.StatusForbidden, &webapi.CurrentSession{})
+		return
+	}
+	err := server.refresh(session)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithError(fasthttp.StatusInternalServerError, err)
+		return
+	}
+	current, err := server.currentSession(session, userID)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithError(fasthttp.StatusBadRequest, err)
+		return
+	}
+	c.JSON(fasthttp.StatusOK, current)
 }
 
+// GetSession returns the logged in user with the role, plan and traffic usage, and the expiry of the session
 func (server *Server) GetSession(c *gin.Context) {
-
+	session := sessions.Default(c)
+	userID := server.sessionUserID(c)
+	if userID == nil {
+		c.AbortWithStatusJSON(fasthttp.StatusForbidden, &webapi.CurrentSession{})
+		return
+	}
+	current, err := server.currentSession(session, userID)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithError(fasthttp.StatusBadRequest, err)
+		return
+	}
+	c.JSON(fasthttp.StatusOK, current)
 }
 
 func (server *Server) PostLog(c *gin.Context) {
@@ -424,7 +468,69 @@ func (server *Server) PostLog(c *gin.Context) {
 }
 
 func (server *Server) DeleteLog(c *gin.Context) {
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err == nil {
+			result := server.DB.DB.Unscoped().Delete(&model.Log{}, id)
+			if result.Error != nil {
+				log.Error(result.Error)
+				c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+			} else if result.RowsAffected == 0 {
+				c.AbortWithStatus(fasthttp.StatusNotFound)
+			} else {
+				c.JSON(fasthttp.StatusOK, &webapi.DeleteLogResponse{
+					Deleted: result.RowsAffected,
+				})
+			}
+		} else {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
 
+// DeleteLogList purges the log records matching the filters of GetLogList, at least one filter is required
+func (server *Server) DeleteLogList(c *gin.Context) {
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		query, filtered, err := server.logQuery(c)
+		if err == nil && !filtered {
+			err = errors.New("a filter is required")
+		}
+		if err == nil {
+			result := query.Unscoped().Delete(&model.Log{})
+			if result.Error != nil {
+				log.Error(result.Error)
+				c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+			} else {
+				log.WithFields(log.Fields{
+					"query": c.Request.URL.RawQuery,
+					"rows":  result.RowsAffected,
+				}).Info("log records purged")
+				c.JSON(fasthttp.StatusOK, &webapi.DeleteLogResponse{
+					Deleted: result.RowsAffected,
+				})
+			}
+		} else {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
 }
 
 func (server *Server) PutLog(c *gin.Context) {
@@ -453,8 +559,8 @@ func (server *Server) GetLogOne(c *gin.Context) {
 					},
 				)
 			} else {
-				log.Error(err)
-				c.AbortWithError(fasthttp.StatusBadRequest, err)
+				log.Error(result.Error)
+				c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
 			}
 		} else {
 			log.Error(err)
@@ -470,23 +576,33 @@ func (server *Server) GetLogOne(c *gin.Context) {
 	}
 }
 
+// GetLogList returns a page of the log records matching the filters, newest first unless order is asc.
+// The next page starts after the ID in the X-Next-Cursor header.
 func (server *Server) GetLogList(c *gin.Context) {
 	role, err := server.GetRole(c)
 	if err == nil && role == model.RoleAdmin {
-		start := c.Query("_start")
-		end := c.Query("_end")
-		sort := c.Query("_sort")
-		order := c.Param("_order")
-		var modelLogs []model.Log
+		query, _, err := server.logQuery(c)
 		var total int64
-		var contentRange int64
-		result := server.DB.DB.Where("id BETWEEN ? and ?", start, end).Order(fmt.Sprintf("%s %s", sort, order)).Find(&modelLogs).Count(&total)
-		if result.Error == nil {
-			server.DB.DB.Table("log").Count(&contentRange)
-			c.Writer.Header().Set("X-Total-Count", strconv.FormatInt(contentRange, 10))
+		if err == nil {
+			err = query.Count(&total).Error
+		}
+		var limit int
+		if err == nil {
+			query, limit, err = logPage(c, query)
+		}
+		var modelLogs []model.Log
+		if err == nil {
+			err = query.Find(&modelLogs).Error
+		}
+		if err == nil {
+			c.Writer.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+			if len(modelLogs) == limit {
+				c.Writer.Header().Set("X-Next-Cursor", strconv.FormatUint(uint64(modelLogs[len(modelLogs)-1].ID), 10))
+			}
 			c.JSON(fasthttp.StatusOK, webapi.GetLogs(modelLogs))
 		} else {
-			c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
 		}
 	} else {
 		if err != nil {
@@ -498,20 +614,130 @@ func (server *Server) GetLogList(c *gin.Context) {
 	}
 }
 
+// PostConfig reloads the configuration file of this node, like SIGHUP
 func (server *Server) PostConfig(c *gin.Context) {
-
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		restart, err := server.ConfigGo.Reload()
+		if err == nil {
+			server.ApplyConfig()
+			for _, key := range restart {
+				log.WithField("key", key).Warn("configuration changed, restart to apply")
+			}
+			log.Info("configuration reloaded")
+			c.JSON(fasthttp.StatusOK, &webapi.PostConfigResponse{
+				Restart: restart,
+			})
+		} else {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
 }
 
+// DeleteConfig removes the runtime settings of the keys in the query, the configuration file applies again.
+// Only an admin logged in with a session can change the settings, the change is recorded under the username.
 func (server *Server) DeleteConfig(c *gin.Context) {
-
+	role, err := server.sessionRole(c)
+	if err == nil && role == model.RoleAdmin {
+		keys := c.QueryArray("key")
+		var username string
+		if len(keys) == 0 {
+			err = errors.New("key is required")
+		} else {
+			username, err = server.sessionUsername(c)
+		}
+		if err == nil {
+			err = server.saveSettings(nil, keys, username)
+		}
+		if err == nil {
+			server.ApplyConfig()
+			log.WithFields(log.Fields{
+				"keys":       keys,
+				"updated_by": username,
+			}).Info("runtime settings removed")
+			c.JSON(fasthttp.StatusOK, webapi.GetConfig(server.ConfigGo))
+		} else {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
 }
 
+// PutConfig sets runtime settings, they are stored in the database and applied by every node without a restart.
+// Only an admin logged in with a session can change the settings, the change is recorded under the username.
 func (server *Server) PutConfig(c *gin.Context) {
-
+	role, err := server.sessionRole(c)
+	if err == nil && role == model.RoleAdmin {
+		request := &webapi.PutConfigRequest{}
+		err := c.BindJSON(request)
+		changed := make(map[string]string, len(request.Settings))
+		keys := make([]string, 0, len(request.Settings))
+		for key, value := range request.Settings {
+			changed[key] = string(value)
+			keys = append(keys, key)
+		}
+		if err == nil && len(changed) == 0 {
+			err = errors.New("settings are required")
+		}
+		if value, ok := changed["server.default_plan"]; ok && err == nil {
+			err = server.DB.DB.Where("id = ?", value).First(&model.Plan{}).Error
+		}
+		var username string
+		if err == nil {
+			username, err = server.sessionUsername(c)
+		}
+		if err == nil {
+			err = server.saveSettings(changed, nil, username)
+		}
+		if err == nil {
+			server.ApplyConfig()
+			log.WithFields(log.Fields{
+				"keys":       keys,
+				"updated_by": username,
+			}).Info("runtime settings changed")
+			c.JSON(fasthttp.StatusOK, webapi.GetConfig(server.ConfigGo))
+		} else {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
 }
 
+// GetConfig returns the effective configuration with the secrets redacted
 func (server *Server) GetConfig(c *gin.Context) {
-
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		c.JSON(fasthttp.StatusOK, webapi.GetConfig(server.ConfigGo))
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
 }
 
 func (server *Server) PostPlan(c *gin.Context) {
@@ -519,11 +745,23 @@ func (server *Server) PostPlan(c *gin.Context) {
 	if err == nil && role == model.RoleAdmin {
 		request := &webapi.PostPlanRequest{}
 		err := c.BindJSON(request)
+		if err == nil {
+			err = server.checkPlanPolicy(request.PortRanges, request.BlockedCategories)
+		}
 		if err == nil {
 			plan := model.Plan{
-				Name:           request.Name,
-				BandwidthLimit: request.BandwidthLimit,
-				TrafficLimit:   request.TrafficLimit,
+				Name:              request.Name,
+				BandwidthLimit:    request.BandwidthLimit,
+				TrafficLimit:      request.TrafficLimit,
+				MaxConnections:    request.MaxConnections,
+				MaxDevices:        request.MaxDevices,
+				CycleDays:         request.CycleDays,
+				DurationDays:      request.DurationDays,
+				ExpiredPlanID:     request.ExpiredPlanID,
+				AllowUDP:          request.AllowUDP,
+				PortRanges:        strings.Join(request.PortRanges, ","),
+				BlockedCategories: strings.Join(request.BlockedCategories, ","),
+				MaxDuration:       request.MaxDuration,
 			}
 			result := server.DB.DB.Save(&plan)
 			if result.Error != nil {
@@ -581,23 +819,36 @@ func (server *Server) PutPlan(c *gin.Context) {
 		id, err := strconv.ParseUint(idStr, 10, 64)
 		if err == nil {
 			err = c.BindJSON(request)
+			if err == nil {
+				err = server.checkPlanPolicy(request.PortRanges, request.BlockedCategories)
+			}
 			if err == nil {
 				result := server.DB.DB.Model(&model.Plan{
 					Model: gorm.Model{
 						ID: uint(id),
 					},
-				}).Updates(model.Plan{
+				}).Select("updated_at", "name", "bandwidth_limit", "traffic_limit", "max_connections", "max_devices", "cycle_days", "duration_days", "expired_plan_id", "allow_udp", "port_ranges", "blocked_categories", "max_duration").Updates(model.Plan{
 					Model: gorm.Model{
 						UpdatedAt: time.Now(),
 					},
-					Name:           request.Name,
-					BandwidthLimit: request.BandwidthLimit,
-					TrafficLimit:   request.TrafficLimit,
+					Name:              request.Name,
+					BandwidthLimit:    request.BandwidthLimit,
+					TrafficLimit:      request.TrafficLimit,
+					MaxConnections:    request.MaxConnections,
+					MaxDevices:        request.MaxDevices,
+					CycleDays:         request.CycleDays,
+					DurationDays:      request.DurationDays,
+					ExpiredPlanID:     request.ExpiredPlanID,
+					AllowUDP:          request.AllowUDP,
+					PortRanges:        strings.Join(request.PortRanges, ","),
+					BlockedCategories: strings.Join(request.BlockedCategories, ","),
+					MaxDuration:       request.MaxDuration,
 				})
 				if result.Error != nil {
 					log.Error(result.Error)
 					c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
 				} else {
+					server.RefreshPlanBuckets(uint(id))
 					c.JSON(fasthttp.StatusOK, request)
 				}
 			} else {
@@ -618,6 +869,22 @@ func (server *Server) PutPlan(c *gin.Context) {
 	}
 }
 
+// checkPlanPolicy validates the port ranges and the blocked categories of a plan
+func (server *Server) checkPlanPolicy(portRanges []string, categories []string) error {
+	for _, s := range portRanges {
+		_, err := util.ParsePortRange(s)
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range categories {
+		if _, ok := server.ConfigGo.Server().Categories[name]; !ok {
+			return errors.New("unknown category: " + name)
+		}
+	}
+	return nil
+}
+
 func (server *Server) GetPlanOne(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 64)
@@ -883,9 +1150,16 @@ func (server *Server) GetNotice(c *gin.Context) {
 	}
 }
 
+// GetRole returns the role of the request, granted by the API token if there is one, otherwise by the session
 func (server *Server) GetRole(c *gin.Context) (uint, error) {
-	session := sessions.Default(c)
-	userIDStr := session.Get("userID")
+	if token, ok := bearerToken(c); ok {
+		return server.tokenRole(c, token)
+	}
+	return server.sessionRole(c)
+}
+
+func (server *Server) sessionRole(c *gin.Context) (uint, error) {
+	userIDStr := server.sessionUserID(c)
 	if userIDStr != nil {
 		if userIDStr == "admin" {
 			return model.RoleAdmin, nil
@@ -907,3 +1181,678 @@ func (server *Server) GetRole(c *gin.Context) (uint, error) {
 		return model.RoleNone, nil
 	}
 }
+
+func (server *Server) GetConnection(c *gin.Context) {
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		query := server.DB.DB.Model(&model.Connection{})
+		for _, key := range []string{"user_id", "username", "client_ip", "close_reason"} {
+			if value, ok := c.GetQuery(key); ok {
+				query = query.Where(key+" = ?", value)
+			}
+		}
+		if addr, ok := c.GetQuery("addr"); ok {
+			query = query.Where("addr LIKE ? OR domain LIKE ?", "%"+addr+"%", "%"+addr+"%")
+		}
+		for key, cond := range map[string]string{"since": "started_at >= ?", "until": "started_at < ?"} {
+			value, ok := c.GetQuery(key)
+			if !ok {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				log.WithField(key, value).Error(err)
+				c.AbortWithError(fasthttp.StatusBadRequest, err)
+				return
+			}
+			query = query.Where(cond, t)
+		}
+		query = query.Session(&gorm.Session{})
+		var total int64
+		result := query.Count(&total)
+		if result.Error != nil {
+			log.Error(result.Error)
+			c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+			return
+		}
+		start, err := strconv.Atoi(c.DefaultQuery("_start", "0"))
+		if err == nil && start < 0 {
+			err = errors.New("invalid _start")
+		}
+		end, errEnd := strconv.Atoi(c.DefaultQuery("_end", strconv.Itoa(start+100)))
+		if err == nil && (errEnd != nil || end < start) {
+			err = errors.New("invalid _end")
+		}
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+			return
+		}
+		sort := "id"
+		switch c.Query("_sort") {
+		case "user_id", "username", "client_ip", "started_at", "ended_at", "up", "down":
+			sort = c.Query("_sort")
+		}
+		order := "DESC"
+		if strings.ToUpper(c.Query("_order")) == "ASC" {
+			order = "ASC"
+		}
+		var modelConnections []model.Connection
+		result = query.Order(sort + " " + order).Offset(start).Limit(end - start).Find(&modelConnections)
+		if result.Error == nil {
+			c.Writer.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+			c.JSON(fasthttp.StatusOK, webapi.GetConnections(modelConnections))
+		} else {
+			log.Error(result.Error)
+			c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
+
+func (server *Server) GetActiveSession(c *gin.Context) {
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		username, filter := c.GetQuery("username")
+		now := time.Now()
+		active := []webapi.ActiveSession{}
+		for _, tunnel := range server.tunnels.List() {
+			if filter && tunnel.Username != username {
+				continue
+			}
+			session := webapi.ActiveSession{
+				ID:       tunnel.ID,
+				UserID:   tunnel.UserID,
+				Username: tunnel.Username,
+				ClientIP: tunnel.ClientIP.String(),
+				Up:       tunnel.Up(),
+				Down:     tunnel.Down(),
+				Start:    tunnel.Start,
+				Age:      int64(now.Sub(tunnel.Start).Seconds()),
+			}
+			if !server.ConfigGo.Server().HideDestination {
+				session.Addr = tunnel.Addr
+				session.Domain = tunnel.Domain
+			}
+			active = append(active, session)
+		}
+		c.Writer.Header().Set("X-Total-Count", strconv.Itoa(len(active)))
+		c.JSON(fasthttp.StatusOK, active)
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
+
+func (server *Server) DeleteActiveSessionOne(c *gin.Context) {
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err == nil {
+			if server.tunnels.Kill(id, model.CloseReasonAdmin) {
+				log.WithField("id", id).Info("tunnel killed by admin")
+				c.JSON(fasthttp.StatusOK, id)
+			} else {
+				c.AbortWithStatus(fasthttp.StatusNotFound)
+			}
+		} else {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
+
+// DeleteActiveSession kills all the tunnels of the user given by the username or user_id query
+func (server *Server) DeleteActiveSession(c *gin.Context) {
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		username := c.Query("username")
+		if userIDStr, ok := c.GetQuery("user_id"); ok {
+			userID, err := strconv.ParseUint(userIDStr, 10, 64)
+			if err != nil {
+				log.WithField("user_id", userIDStr).Error(err)
+				c.AbortWithError(fasthttp.StatusBadRequest, err)
+				return
+			}
+			user := &model.User{}
+			result := server.DB.DB.First(user, userID)
+			if result.Error != nil {
+				log.Error(result.Error)
+				c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+				return
+			}
+			username = user.Username
+		}
+		if username == "" {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+			return
+		}
+		n := server.tunnels.KillUser(username, model.CloseReasonAdmin)
+		log.WithFields(log.Fields{
+			"username": username,
+			"tunnels":  n,
+		}).Info("tunnels of user killed by admin")
+		c.JSON(fasthttp.StatusOK, webapi.DeleteActiveSessionResponse{
+			Killed: n,
+		})
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
+
+func (server *Server) GetNode(c *gin.Context) {
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		var modelNodes []model.Node
+		result := server.DB.DB.Order("name").Find(&modelNodes)
+		if result.Error == nil {
+			c.Writer.Header().Set("X-Total-Count", strconv.Itoa(len(modelNodes)))
+			c.JSON(fasthttp.StatusOK, webapi.GetNodes(modelNodes, server.nodeTimeout()))
+		} else {
+			log.Error(result.Error)
+			c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
+
+func (server *Server) GetNodeOne(c *gin.Context) {
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err == nil {
+			modelNode := &model.Node{}
+			result := server.DB.DB.First(modelNode, id)
+			if result.Error == nil {
+				c.JSON(fasthttp.StatusOK, webapi.GetNode(*modelNode, server.nodeTimeout()))
+			} else {
+				log.Error(result.Error)
+				c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+			}
+		} else {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
+
+// PutNode enables, disables or drains a node, the node picks up the change at its next heartbeat
+func (server *Server) PutNode(c *gin.Context) {
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		request := &webapi.PutNodeRequest{}
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err == nil {
+			err = c.BindJSON(request)
+		}
+		if err == nil {
+			updates := map[string]interface{}{
+				"updated_at": time.Now(),
+			}
+			if request.Enabled != nil {
+				updates["enabled"] = *request.Enabled
+			}
+			if request.Draining != nil {
+				updates["draining"] = *request.Draining
+			}
+			result := server.DB.DB.Model(&model.Node{}).Where("id = ?", id).Updates(updates)
+			if result.Error == nil && result.RowsAffected == 0 {
+				c.AbortWithStatus(fasthttp.StatusNotFound)
+				return
+			}
+			modelNode := &model.Node{}
+			if result.Error == nil {
+				result = server.DB.DB.First(modelNode, id)
+			}
+			if result.Error == nil {
+				log.WithFields(log.Fields{
+					"node":     modelNode.Name,
+					"enabled":  modelNode.Enabled,
+					"draining": modelNode.Draining,
+				}).Info("node updated by admin")
+				c.JSON(fasthttp.StatusOK, webapi.GetNode(*modelNode, server.nodeTimeout()))
+			} else {
+				log.Error(result.Error)
+				c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+			}
+		} else {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
+
+// DeleteNode removes the record of a node which is down
+func (server *Server) DeleteNode(c *gin.Context) {
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		modelNode := &model.Node{}
+		if err == nil {
+			err = server.DB.DB.First(modelNode, id).Error
+		}
+		if err == nil {
+			if time.Since(modelNode.LastHeartbeat) < server.nodeTimeout() {
+				c.AbortWithError(fasthttp.StatusConflict, errors.New("node is alive"))
+				return
+			}
+			err = server.DB.DB.Transaction(func(tx *gorm.DB) error {
+				err := tx.Where("node_id = ?", id).Delete(&model.NodeUser{}).Error
+				if err != nil {
+					return err
+				}
+				return tx.Unscoped().Delete(modelNode).Error
+			})
+		}
+		if err == nil {
+			c.JSON(fasthttp.StatusOK, id)
+		} else {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
+
+// GetWebSession lists the logged in sessions of the db session store, optionally filtered by user_id or username
+func (server *Server) GetWebSession(c *gin.Context) {
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		if server.ConfigGo.Server().SessionStore != config.SessionStoreDB {
+			c.AbortWithError(fasthttp.StatusNotImplemented, errSessionStoreNotDB)
+			return
+		}
+		query := server.DB.DB.Where("username <> '' AND expires_at > ?", time.Now())
+		for _, key := range []string{"user_id", "username"} {
+			if value, ok := c.GetQuery(key); ok {
+				query = query.Where(key+" = ?", value)
+			}
+		}
+		var modelSessions []model.Session
+		result := query.Order("updated_at DESC").Find(&modelSessions)
+		if result.Error == nil {
+			c.Writer.Header().Set("X-Total-Count", strconv.Itoa(len(modelSessions)))
+			c.JSON(fasthttp.StatusOK, webapi.GetWebSessions(modelSessions))
+		} else {
+			log.Error(result.Error)
+			c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
+
+func (server *Server) DeleteWebSessionOne(c *gin.Context) {
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		if server.ConfigGo.Server().SessionStore != config.SessionStoreDB {
+			c.AbortWithError(fasthttp.StatusNotImplemented, errSessionStoreNotDB)
+			return
+		}
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err == nil {
+			result := server.DB.DB.Unscoped().Delete(&model.Session{}, id)
+			if result.Error != nil {
+				log.Error(result.Error)
+				c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+			} else if result.RowsAffected == 0 {
+				c.AbortWithStatus(fasthttp.StatusNotFound)
+			} else {
+				log.WithField("id", id).Info("session revoked by admin")
+				c.JSON(fasthttp.StatusOK, id)
+			}
+		} else {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
+
+// DeleteWebSession revokes all the sessions of the user given by the username or user_id query
+func (server *Server) DeleteWebSession(c *gin.Context) {
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		if server.ConfigGo.Server().SessionStore != config.SessionStoreDB {
+			c.AbortWithError(fasthttp.StatusNotImplemented, errSessionStoreNotDB)
+			return
+		}
+		query := server.DB.DB.Unscoped()
+		if userID, ok := c.GetQuery("user_id"); ok {
+			query = query.Where("user_id = ?", userID)
+		} else if username := c.Query("username"); username != "" {
+			query = query.Where("username = ?", username)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+			return
+		}
+		result := query.Delete(&model.Session{})
+		if result.Error == nil {
+			log.WithFields(log.Fields{
+				"user_id":  c.Query("user_id"),
+				"username": c.Query("username"),
+				"revoked":  result.RowsAffected,
+			}).Info("sessions revoked by admin")
+			c.JSON(fasthttp.StatusOK, &webapi.DeleteWebSessionResponse{
+				Revoked: result.RowsAffected,
+			})
+		} else {
+			log.Error(result.Error)
+			c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
+
+// PutUserPassword changes the password of the logged in user, id is "me" or the ID of the user.
+// The other sessions of the user are revoked.
+func (server *Server) PutUserPassword(c *gin.Context) {
+	session := sessions.Default(c)
+	userID, ok := server.sessionUserID(c).(uint)
+	if !ok || (c.Param("id") != "me" && c.Param("id") != strconv.FormatUint(uint64(userID), 10)) {
+		c.AbortWithStatus(fasthttp.StatusForbidden)
+		return
+	}
+	request := &webapi.PutUserPasswordRequest{}
+	err := c.BindJSON(request)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithError(fasthttp.StatusBadRequest, err)
+		return
+	}
+	oldKey, err := decodePassword(request.OldPassword)
+	if err == nil {
+		var newKey []byte
+		newKey, err = decodePassword(request.NewPassword)
+		if err == nil {
+			user := &model.User{}
+			err = server.DB.DB.First(user, userID).Error
+			if err == nil {
+				err = user.CheckPassword(oldKey)
+				if err != nil {
+					log.WithFields(log.Fields{
+						"client_ip": c.ClientIP(),
+						"username":  user.Username,
+					}).Warn("wrong password")
+					c.JSON(fasthttp.StatusForbidden, &webapi.PutUserPasswordResponse{
+						OK:       false,
+						ErrorMsg: "Wrong password",
+					})
+					return
+				}
+				err = server.DB.DB.Transaction(func(tx *gorm.DB) error {
+					return server.setPassword(tx, user, newKey)
+				})
+				if err == nil {
+					log.WithField("username", user.Username).Info("password changed")
+				}
+			}
+		}
+	}
+	if err != nil {
+		log.Error(err)
+		c.AbortWithError(fasthttp.StatusBadRequest, err)
+		return
+	}
+	err = server.login(session, userID)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithError(fasthttp.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(fasthttp.StatusOK, &webapi.PutUserPasswordResponse{
+		OK:       true,
+		ErrorMsg: "",
+	})
+}
+
+// PostPasswordReset issues a one-time token to set the password of the user, valid for a day
+func (server *Server) PostPasswordReset(c *gin.Context) {
+	role, err := server.GetRole(c)
+	if err == nil && role == model.RoleAdmin {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		user := &model.User{}
+		if err == nil {
+			err = server.DB.DB.First(user, id).Error
+		}
+		if err == nil {
+			token, reset, err := server.newPasswordReset(user.ID)
+			if err == nil {
+				log.WithField("username", user.Username).Info("password reset issued")
+				c.JSON(fasthttp.StatusOK, &webapi.PostPasswordResetResponse{
+					Token:     token,
+					ExpiresAt: reset.ExpiresAt,
+				})
+			} else {
+				log.Error(err)
+				c.AbortWithError(fasthttp.StatusInternalServerError, err)
+			}
+		} else {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
+
+// PutPasswordReset sets the password of a user with a reset token, the sessions of the user are revoked
+func (server *Server) PutPasswordReset(c *gin.Context) {
+	request := &webapi.PutPasswordResetRequest{}
+	err := c.BindJSON(request)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithError(fasthttp.StatusBadRequest, err)
+		return
+	}
+	sha512key, err := decodePassword(request.Password)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithError(fasthttp.StatusBadRequest, err)
+		return
+	}
+	_, err = server.redeemPasswordReset(request.Token, sha512key)
+	if errors.Is(err, ErrResetToken) {
+		log.WithField("client_ip", c.ClientIP()).Warn(err)
+		c.JSON(fasthttp.StatusForbidden, &webapi.PutUserPasswordResponse{
+			OK:       false,
+			ErrorMsg: "Invalid token",
+		})
+		return
+	}
+	if err != nil {
+		log.Error(err)
+		c.AbortWithError(fasthttp.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(fasthttp.StatusOK, &webapi.PutUserPasswordResponse{
+		OK:       true,
+		ErrorMsg: "",
+	})
+}
+
+// PostAPIToken creates an API token, only an admin logged in with a session can manage the tokens
+func (server *Server) PostAPIToken(c *gin.Context) {
+	role, err := server.sessionRole(c)
+	if err == nil && role == model.RoleAdmin {
+		request := &webapi.PostAPITokenRequest{}
+		err := c.BindJSON(request)
+		if err == nil && (request.Name == "" || len(request.Scopes) == 0) {
+			err = errors.New("name and scopes are required")
+		}
+		if err == nil {
+			for _, scope := range request.Scopes {
+				if !model.ValidScope(scope) {
+					err = fmt.Errorf("unknown scope: %s", scope)
+					break
+				}
+			}
+		}
+		var createdBy string
+		if err == nil {
+			createdBy, err = server.sessionUsername(c)
+		}
+		if err == nil {
+			token, prefix := newAPIToken()
+			apiToken := model.APIToken{
+				Name:      request.Name,
+				TokenHash: hashToken(token),
+				Prefix:    prefix,
+				Scopes:    strings.Join(request.Scopes, ","),
+				CreatedBy: createdBy,
+			}
+			if request.ExpiresIn > 0 {
+				expiresAt := time.Now().Add(time.Duration(request.ExpiresIn) * time.Second)
+				apiToken.ExpiresAt = &expiresAt
+			}
+			result := server.DB.DB.Create(&apiToken)
+			if result.Error != nil {
+				log.Error(result.Error)
+				c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+			} else {
+				log.WithFields(log.Fields{
+					"token":      apiToken.Name,
+					"scopes":     apiToken.Scopes,
+					"created_by": createdBy,
+				}).Info("API token created")
+				c.JSON(fasthttp.StatusOK, &webapi.PostAPITokenResponse{
+					APIToken: webapi.GetAPIToken(apiToken),
+					Token:    token,
+				})
+			}
+		} else {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
+
+// DeleteAPIToken revokes an API token
+func (server *Server) DeleteAPIToken(c *gin.Context) {
+	role, err := server.sessionRole(c)
+	if err == nil && role == model.RoleAdmin {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err == nil {
+			result := server.DB.DB.Delete(&model.APIToken{}, id)
+			if result.Error != nil {
+				log.Error(result.Error)
+				c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+			} else if result.RowsAffected == 0 {
+				c.AbortWithStatus(fasthttp.StatusNotFound)
+			} else {
+				log.WithField("id", id).Info("API token revoked")
+				c.Status(fasthttp.StatusOK)
+			}
+		} else {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
+
+// GetAPIToken lists the API tokens which are not revoked, including the expired ones
+func (server *Server) GetAPIToken(c *gin.Context) {
+	role, err := server.sessionRole(c)
+	if err == nil && role == model.RoleAdmin {
+		var apiTokens []model.APIToken
+		result := server.DB.DB.Order("id").Find(&apiTokens)
+		if result.Error == nil {
+			c.Writer.Header().Set("X-Total-Count", strconv.Itoa(len(apiTokens)))
+			c.JSON(fasthttp.StatusOK, webapi.GetAPITokens(apiTokens))
+		} else {
+			log.Error(result.Error)
+			c.AbortWithError(fasthttp.StatusBadRequest, result.Error)
+		}
+	} else {
+		if err != nil {
+			log.Error(err)
+			c.AbortWithError(fasthttp.StatusBadRequest, err)
+		} else {
+			c.AbortWithStatus(fasthttp.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package core
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+	"github.com/iyouport-org/relaybaton/pkg/config"
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	"github.com/iyouport-org/relaybaton/pkg/webapi"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/hkdf"
+	"gorm.io/gorm"
+)
+
+const (
+	sessionName       = "relaybaton_session"
+	sessionMaxAge     = 30 * 24 * time.Hour //also the limit of the signed cookies
+	sessionSecretSize = 64
+)
+
+// values of the session
+const (
+	sessionKeyUserID  = "userID"  //uint ID of the user, or "admin"
+	sessionKeyLoginAt = "loginAt" //unix time
+	sessionKeySeenAt  = "seenAt"  //unix time of the login or the last refresh
+)
+
+var errSessionStoreNotDB = errors.New("server.session_store is not db")
+
+type clientIPKey struct{}
+
+// sessionKeyPairs derives the authentication and encryption keys of each secret, in the order of the secrets
+func sessionKeyPairs(secrets []string) ([][]byte, error) {
+	var pairs [][]byte
+	for _, secret := range secrets {
+		kdf := hkdf.New(sha512.New, []byte(secret), nil, []byte(sessionName))
+		authKey := make([]byte, 64)
+		cryptKey := make([]byte, 32)
+		_, err := io.ReadFull(kdf, authKey)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.ReadFull(kdf, cryptKey)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, authKey, cryptKey)
+	}
+	return pairs, nil
+}
+
+// loadSessionSecrets returns server.session_keys, or else the secrets in the database, newest first.
+// A secret is generated when there is none, so that the nodes sharing the database share the sessions.
+func (server *Server) loadSessionSecrets() ([]string, error) {
+	serverConf := server.ConfigGo.Server()
+	if len(serverConf.SessionKeys) > 0 {
+		return serverConf.SessionKeys, nil
+	}
+	var keys []model.SessionKey
+	err := server.DB.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Order("id DESC").Find(&keys).Error
+		if err != nil || len(keys) > 0 {
+			return err
+		}
+		key, err := NewSessionKey()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, *key)
+		return tx.Create(key).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	secrets := make([]string, len(keys))
+	for k, key := range keys {
+		secrets[k] = key.Secret
+	}
+	return secrets, nil
+}
+
+// NewSessionKey generates a random session secret
+func NewSessionKey() (*model.SessionKey, error) {
+	secret := securecookie.GenerateRandomKey(sessionSecretSize)
+	if secret == nil {
+		return nil, errors.New("session key not generated")
+	}
+	return &model.SessionKey{
+		Secret: base64.StdEncoding.EncodeToString(secret),
+	}, nil
+}
+
+// newSessionStore creates the session store selected by server.session_store
+func (server *Server) newSessionStore() (sessions.Store, error) {
+	secrets, err := server.loadSessionSecrets()
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := sessionKeyPairs(secrets)
+	if err != nil {
+		return nil, err
+	}
+	var store sessions.Store
+	if server.ConfigGo.Server().SessionStore == config.SessionStoreDB {
+		store = NewDBSessionStore(server.DB.DB, pairs...)
+	} else {
+		store = cookie.NewStore(pairs...)
+	}
+	store.Options(server.sessionOptions(server.ConfigGo.Server().SessionLifetime))
+	return store, nil
+}
+
+func (server *Server) sessionOptions(maxAge time.Duration) sessions.Options {
+	return sessions.Options{
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+	}
+}
+
+// sessionUserID returns the user of the session, or nil if the visitor is not logged in.
+// A session past its idle timeout or its lifetime is logged out.
+func (server *Server) sessionUserID(c *gin.Context) interface{} {
+	session := sessions.Default(c)
+	userID := session.Get(sessionKeyUserID)
+	if userID == nil {
+		return nil
+	}
+	if _, _, ok := server.sessionExpiry(session, time.Now()); !ok || server.sessionRevoked(session, userID) {
+		err := server.logout(session)
+		if err != nil {
+			log.Error(err)
+		}
+		return nil
+	}
+	return userID
+}
+
+// sessionExpiry returns when the session reaches its lifetime and its idle timeout, ok is false if it is expired
+func (server *Server) sessionExpiry(session sessions.Session, now time.Time) (expiresAt time.Time, idleExpiresAt time.Time, ok bool) {
+	loginAt, ok := session.Get(sessionKeyLoginAt).(int64)
+	if !ok {
+		return expiresAt, idleExpiresAt, false
+	}
+	seenAt, ok := session.Get(sessionKeySeenAt).(int64)
+	if !ok {
+		return expiresAt, idleExpiresAt, false
+	}
+	serverConf := server.ConfigGo.Server()
+	expiresAt = time.Unix(loginAt, 0).Add(serverConf.SessionLifetime)
+	idleExpiresAt = time.Unix(seenAt, 0).Add(serverConf.SessionIdleTimeout)
+	if idleExpiresAt.After(expiresAt) {
+		idleExpiresAt = expiresAt
+	}
+	return expiresAt, idleExpiresAt, now.Before(idleExpiresAt)
+}
+
+// sessionRevoked reports whether the user of the session is deleted or changed the password after the login
+func (server *Server) sessionRevoked(session sessions.Session, userID interface{}) bool {
+	id, ok := userID.(uint)
+	if !ok {
+		return false
+	}
+	user := model.User{}
+	result := server.DB.DB.Select("password_changed_at").Limit(1).Find(&user, id)
+	if result.Error != nil {
+		log.WithField("user_id", id).Error(result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return true
+	}
+	loginAt, _ := session.Get(sessionKeyLoginAt).(int64)
+	return user.PasswordChangedAt != nil && loginAt < user.PasswordChangedAt.Unix()
+}
+
+// revokeSessions deletes the sessions of the user kept by the db session store,
+// the cookie sessions are revoked by the password_changed_at of the user
+func (server *Server) revokeSessions(tx *gorm.DB, userID uint) error {
+	return tx.Unscoped().Where("user_id = ?", userID).Delete(&model.Session{}).Error
+}
+
+// login starts the session of the user, its cookie lasts until the end of the session lifetime.
+// The db session store issues a new token, so that a token obtained before the login is worthless.
+func (server *Server) login(session sessions.Session, userID interface{}) error {
+	if s, ok := session.(interface{ Session() *gsessions.Session }); ok && s.Session() != nil {
+		if store, ok := s.Session().Store().(*DBSessionStore); ok {
+			err := store.renew(s.Session())
+			if err != nil {
+				return err
+			}
+		}
+	}
+	now := time.Now().Unix()
+	session.Set(sessionKeyUserID, userID)
+	session.Set(sessionKeyLoginAt, now)
+	session.Set(sessionKeySeenAt, now)
+	session.Options(server.sessionOptions(server.ConfigGo.Server().SessionLifetime))
+	return session.Save()
+}
+
+// refresh postpones the idle timeout of the session, the lifetime is kept
+func (server *Server) refresh(session sessions.Session) error {
+	now := time.Now()
+	session.Set(sessionKeySeenAt, now.Unix())
+	expiresAt, _, _ := server.sessionExpiry(session, now)
+	session.Options(server.sessionOptions(expiresAt.Sub(now)))
+	return session.Save()
+}
+
+// logout clears the session and deletes its cookie
+func (server *Server) logout(session sessions.Session) error {
+	session.Clear()
+	session.Options(sessions.Options{
+		Path:   "/",
+		MaxAge: -1,
+	})
+	return session.Save()
+}
+
+// currentSession describes the session of the logged in user
+func (server *Server) currentSession(session sessions.Session, userID interface{}) (*webapi.CurrentSession, error) {
+	current := &webapi.CurrentSession{}
+	if userID == "admin" {
+		current.User = webapi.GetAdminUser()
+	} else {
+		user := &model.User{}
+		result := server.DB.DB.Preload("Plan").First(user, userID)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		current.User = webapi.GetUser(*user)
+	}
+	loginAt, _ := session.Get(sessionKeyLoginAt).(int64)
+	current.LoginAt = time.Unix(loginAt, 0)
+	current.ExpiresAt, current.IdleExpiresAt, _ = server.sessionExpiry(session, time.Now())
+	return current, nil
+}
+
+// withClientIP passes the client address to the session store
+func (server *Server) withClientIP(c *gin.Context) {
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), clientIPKey{}, c.ClientIP()))
+	c.Next()
+}
+
+// purgeSessions deletes the expired sessions of the db session store
+func (server *Server) purgeSessions() {
+	result := server.DB.DB.Unscoped().Where("expires_at < ?", time.Now()).Delete(&model.Session{})
+	if result.Error != nil {
+		log.Error(result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.WithField("rows", result.RowsAffected).Debug("expired sessions purged")
+	}
+}
+
+// DBSessionStore keeps the sessions in the database, the cookie only carries the signed token of the session.
+// Sessions can then be listed and revoked, and they are shared by the nodes using the same database.
+type DBSessionStore struct {
+	db      *gorm.DB
+	codecs  []securecookie.Codec
+	options *gsessions.Options
+}
+
+func NewDBSessionStore(db *gorm.DB, keyPairs ...[]byte) *DBSessionStore {
+	return &DBSessionStore{
+		db:     db,
+		codecs: securecookie.CodecsFromPairs(keyPairs...),
+		options: &gsessions.Options{
+			Path:   "/",
+			MaxAge: int(sessionMaxAge.Seconds()),
+		},
+	}
+}
+
+func (store *DBSessionStore) Options(options sessions.Options) {
+	store.options = options.ToGorillaOptions()
+}
+
+func (store *DBSessionStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(store, name)
+}
+
+// New loads the session of the cookie, or returns a new session if the cookie is invalid or the session is revoked or expired
+func (store *DBSessionStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(store, name)
+	options := *store.options
+	session.Options = &options
+	session.IsNew = true
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var token string
+	err = securecookie.DecodeMulti(name, c.Value, &token, store.codecs...)
+	if err != nil {
+		return session, nil
+	}
+	record := model.Session{}
+	result := store.db.Where("token = ? AND expires_at > ?", token, time.Now()).Limit(1).Find(&record)
+	if result.Error != nil {
+		return session, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return session, nil
+	}
+	err = securecookie.GobEncoder{}.Deserialize(record.Data, &session.Values)
+	if err != nil {
+		return session, err
+	}
+	session.ID = record.Token
+	session.IsNew = false
+	return session, nil
+}
+
+// renew deletes the stored session, Save then issues a new token
+func (store *DBSessionStore) renew(session *gsessions.Session) error {
+	if session.ID == "" {
+		return nil
+	}
+	err := store.db.Unscoped().Where("token = ?", session.ID).Delete(&model.Session{}).Error
+	if err != nil {
+		return err
+	}
+	session.ID = ""
+	return nil
+}
+
+// Save writes the session to the database and its token to the cookie, a negative MaxAge deletes the session
+func (store *DBSessionStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			err := store.db.Unscoped().Where("token = ?", session.ID).Delete(&model.Session{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+	if session.ID == "" {
+		session.ID = hex.EncodeToString(securecookie.GenerateRandomKey(32))
+	}
+	data, err := securecookie.GobEncoder{}.Serialize(session.Values)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	record := model.Session{
+		Model: gorm.Model{
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		Token:     session.ID,
+		Data:      data,
+		UserAgent: r.UserAgent(),
+		ExpiresAt: now.Add(time.Duration(session.Options.MaxAge) * time.Second),
+	}
+	if clientIP, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		record.ClientIP = clientIP
+	}
+	switch userID := session.Values[sessionKeyUserID].(type) {
+	case string:
+		record.Username = userID
+	case uint:
+		record.UserID = userID
+		user := model.User{}
+		if store.db.Select("username").Limit(1).Find(&user, userID).Error == nil {
+			record.Username = user.Username
+		}
+	}
+	result := store.db.Model(&model.Session{}).Where("token = ?", record.Token).
+		Select("updated_at", "data", "user_id", "username", "client_ip", "user_agent", "expires_at").Updates(&record)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		err = store.db.Create(&record).Error
+		if err != nil {
+			return err
+		}
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, store.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
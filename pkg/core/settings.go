@@ -0,0 +1,82 @@
+package core
+
+import (
+	"reflect"
+
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// loadSettings reads the runtime settings overriding the configuration file
+func (server *Server) loadSettings(tx *gorm.DB) (map[string]string, error) {
+	var rows []model.Setting
+	err := tx.Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	settings := make(map[string]string, len(rows))
+	for _, row := range rows {
+		settings[row.Name] = row.Value
+	}
+	return settings, nil
+}
+
+// syncSettings applies the runtime settings changed in the database by the other nodes,
+// settings which failed to apply are skipped until they change
+func (server *Server) syncSettings() {
+	settings, err := server.loadSettings(server.DB.DB)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if reflect.DeepEqual(settings, server.ConfigGo.Settings()) || reflect.DeepEqual(settings, server.rejected) {
+		return
+	}
+	err = server.ConfigGo.ApplySettings(settings)
+	if err != nil {
+		//logged once, until the settings change again
+		server.rejected = settings
+		log.WithField("settings", settings).Error(err)
+		return
+	}
+	server.rejected = nil
+	server.ApplyConfig()
+	log.Info("runtime settings applied")
+}
+
+// saveSettings stores the runtime settings and applies them once committed, the database is only changed if they are valid.
+// They are validated before the transaction, since the validation logs its errors to the database.
+func (server *Server) saveSettings(changed map[string]string, deleted []string, updatedBy string) error {
+	settings := server.ConfigGo.Settings()
+	for name, value := range changed {
+		settings[name] = value
+	}
+	for _, name := range deleted {
+		delete(settings, name)
+	}
+	err := server.ConfigGo.ValidateSettings(settings)
+	if err != nil {
+		return err
+	}
+	err = server.DB.DB.Transaction(func(tx *gorm.DB) error {
+		for name, value := range changed {
+			err := tx.Save(&model.Setting{
+				Name:      name,
+				Value:     value,
+				UpdatedBy: updatedBy,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(deleted) > 0 {
+			return tx.Where("name IN ?", deleted).Delete(&model.Setting{}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return server.ConfigGo.ApplySettings(settings)
+}
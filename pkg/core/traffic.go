@@ -0,0 +1,61 @@
+package core
+
+import (
+	"time"
+
+	"github.com/iyouport-org/relaybaton/pkg/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// FlushTraffic writes the traffic used since the last flush to the database,
+// then cuts the tunnels of the users who ran out of traffic
+func (server *Server) FlushTraffic() {
+	usage := server.tunnels.Usage()
+	if len(usage) > 0 {
+		start := time.Now()
+		err := server.DB.DB.Transaction(func(tx *gorm.DB) error {
+			for username, delta := range usage {
+				err := tx.Model(&model.User{}).Where("username = ?", username).
+					Update("traffic_used", gorm.Expr("traffic_used + ?", delta)).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		server.observeQuery("flush_traffic", start)
+		if err != nil {
+			log.WithField("users", len(usage)).Error(err)
+			server.tunnels.Restore(usage)
+			return
+		}
+	}
+	server.enforceQuota()
+}
+
+func (server *Server) enforceQuota() {
+	usernames := server.tunnels.Users()
+	if len(usernames) == 0 {
+		return
+	}
+	var users []model.User
+	err := server.DB.DB.Preload("Plan").Where("username IN ?", usernames).Find(&users).Error
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, user := range users {
+		if user.Username == "admin" || user.Plan.TrafficLimit > user.TrafficUsed {
+			continue
+		}
+		n := server.tunnels.KillUser(user.Username, model.CloseReasonQuota)
+		log.WithFields(log.Fields{
+			"username": user.Username,
+			"plan":     user.Plan.Name,
+			"limit":    user.Plan.TrafficLimit,
+			"used":     user.TrafficUsed,
+			"tunnels":  n,
+		}).Info("traffic running out, tunnels closed")
+	}
+}
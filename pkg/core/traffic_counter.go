@@ -0,0 +1,30 @@
+package core
+
+import "sync/atomic"
+
+const (
+	RouteProxy  = "proxy"
+	RouteDirect = "direct"
+)
+
+// TrafficCounter counts the bytes sent and received, it is safe for concurrent use
+type TrafficCounter struct {
+	up   uint64
+	down uint64
+}
+
+func (counter *TrafficCounter) AddUp(n int) {
+	atomic.AddUint64(&counter.up, uint64(n))
+}
+
+func (counter *TrafficCounter) AddDown(n int) {
+	atomic.AddUint64(&counter.down, uint64(n))
+}
+
+func (counter *TrafficCounter) Up() uint64 {
+	return atomic.LoadUint64(&counter.up)
+}
+
+func (counter *TrafficCounter) Down() uint64 {
+	return atomic.LoadUint64(&counter.down)
+}
@@ -0,0 +1,285 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/emirpasic/gods/maps/hashmap"
+	"github.com/iyouport-org/relaybaton/pkg/model"
+)
+
+var (
+	ErrTooManyConnections = errors.New("too many concurrent connections")
+	ErrTooManyDevices     = errors.New("too many devices")
+)
+
+// Tunnel is a connection relayed by the server for a client
+type Tunnel struct {
+	ID       uint64
+	UserID   uint
+	Username string
+	ClientIP net.IP
+	Addr     string
+	Domain   string
+	Start    time.Time
+	up       uint64 //client to destination, accessed atomically
+	down     uint64 //destination to client, accessed atomically
+	flushed  uint64 //traffic already accounted, guarded by TunnelMap.mutex
+	mutex    sync.Mutex
+	closer   func()
+	closed   bool
+	reason   string
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func NewTunnel(userID uint, username string, clientIP net.IP, addr string, domain string) *Tunnel {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Tunnel{
+		UserID:   userID,
+		Username: username,
+		ClientIP: clientIP,
+		Addr:     addr,
+		Domain:   domain,
+		Start:    time.Now(),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Context is done when the tunnel is killed
+func (tunnel *Tunnel) Context() context.Context {
+	return tunnel.ctx
+}
+
+func (tunnel *Tunnel) AddUp(n int) {
+	atomic.AddUint64(&tunnel.up, uint64(n))
+}
+
+func (tunnel *Tunnel) AddDown(n int) {
+	atomic.AddUint64(&tunnel.down, uint64(n))
+}
+
+func (tunnel *Tunnel) Up() uint64 {
+	return atomic.LoadUint64(&tunnel.up)
+}
+
+func (tunnel *Tunnel) Down() uint64 {
+	return atomic.LoadUint64(&tunnel.down)
+}
+
+// Bind sets the function which tears down the connections of the tunnel
+func (tunnel *Tunnel) Bind(closer func()) {
+	tunnel.mutex.Lock()
+	defer tunnel.mutex.Unlock()
+	tunnel.closer = closer
+	if tunnel.closed {
+		closer()
+	}
+}
+
+// Kill tears down the connections of the tunnel
+func (tunnel *Tunnel) Kill() {
+	tunnel.mutex.Lock()
+	defer tunnel.mutex.Unlock()
+	if tunnel.closed {
+		return
+	}
+	tunnel.closed = true
+	tunnel.cancel()
+	if tunnel.closer != nil {
+		tunnel.closer()
+	}
+}
+
+// KillWith tears down the connections of the tunnel and records why, unless the tunnel is already closed
+func (tunnel *Tunnel) KillWith(reason string) {
+	tunnel.mutex.Lock()
+	if tunnel.reason == "" {
+		tunnel.reason = reason
+	}
+	tunnel.mutex.Unlock()
+	tunnel.Kill()
+}
+
+// Reason returns why the tunnel was closed
+func (tunnel *Tunnel) Reason() string {
+	tunnel.mutex.Lock()
+	defer tunnel.mutex.Unlock()
+	return tunnel.reason
+}
+
+// TunnelMap is the registry of the active tunnels on the server
+type TunnelMap struct {
+	mutex   sync.RWMutex
+	tunnels *hashmap.Map
+	pending map[string]uint64 //traffic of closed tunnels not accounted yet
+	nextID  uint64
+}
+
+func NewTunnelMap() *TunnelMap {
+	return &TunnelMap{
+		mutex:   sync.RWMutex{},
+		tunnels: hashmap.New(),
+		pending: map[string]uint64{},
+	}
+}
+
+// Open registers the tunnel if the plan of the user allows another one,
+// remote is the number of tunnels of the user on the other nodes of the cluster
+func (m *TunnelMap) Open(tunnel *Tunnel, plan model.Plan, remote uint) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	connections := remote
+	devices := map[string]bool{}
+	for _, v := range m.tunnels.Values() {
+		t := v.(*Tunnel)
+		if t.Username != tunnel.Username {
+			continue
+		}
+		connections++
+		devices[t.ClientIP.String()] = true
+	}
+	if plan.MaxConnections != 0 && connections >= plan.MaxConnections {
+		return ErrTooManyConnections
+	}
+	if plan.MaxDevices != 0 && !devices[tunnel.ClientIP.String()] && uint(len(devices)) >= plan.MaxDevices {
+		return ErrTooManyDevices
+	}
+	m.nextID++
+	tunnel.ID = m.nextID
+	m.tunnels.Put(tunnel.ID, tunnel)
+	return nil
+}
+
+func (m *TunnelMap) Close(tunnel *Tunnel) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.tunnels.Get(tunnel.ID); !ok {
+		return
+	}
+	m.tunnels.Remove(tunnel.ID)
+	if delta := tunnel.Up() + tunnel.Down() - tunnel.flushed; delta > 0 {
+		m.pending[tunnel.Username] += delta
+	}
+}
+
+// Usage returns the traffic of each user since the last call
+func (m *TunnelMap) Usage() map[string]uint64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	usage := m.pending
+	m.pending = map[string]uint64{}
+	for _, v := range m.tunnels.Values() {
+		t := v.(*Tunnel)
+		total := t.Up() + t.Down()
+		if delta := total - t.flushed; delta > 0 {
+			usage[t.Username] += delta
+			t.flushed = total
+		}
+	}
+	return usage
+}
+
+// Restore gives back the traffic which failed to be accounted
+func (m *TunnelMap) Restore(usage map[string]uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for username, delta := range usage {
+		m.pending[username] += delta
+	}
+}
+
+// HasUser reports whether the user has active tunnels
+func (m *TunnelMap) HasUser(username string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, v := range m.tunnels.Values() {
+		if v.(*Tunnel).Username == username {
+			return true
+		}
+	}
+	return false
+}
+
+// Users returns the usernames which have active tunnels
+func (m *TunnelMap) Users() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	set := map[string]bool{}
+	var users []string
+	for _, v := range m.tunnels.Values() {
+		t := v.(*Tunnel)
+		if !set[t.Username] {
+			set[t.Username] = true
+			users = append(users, t.Username)
+		}
+	}
+	return users
+}
+
+// Counts returns the number of active tunnels of each user
+func (m *TunnelMap) Counts() map[string]uint {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	counts := map[string]uint{}
+	for _, v := range m.tunnels.Values() {
+		counts[v.(*Tunnel).Username]++
+	}
+	return counts
+}
+
+// Len returns the number of active tunnels
+func (m *TunnelMap) Len() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.tunnels.Size()
+}
+
+// List returns the active tunnels ordered by ID
+func (m *TunnelMap) List() []*Tunnel {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	tunnels := make([]*Tunnel, 0, m.tunnels.Size())
+	for _, v := range m.tunnels.Values() {
+		tunnels = append(tunnels, v.(*Tunnel))
+	}
+	sort.Slice(tunnels, func(i, j int) bool {
+		return tunnels[i].ID < tunnels[j].ID
+	})
+	return tunnels
+}
+
+// Kill tears down the tunnel of id, it reports whether the tunnel is active
+func (m *TunnelMap) Kill(id uint64, reason string) bool {
+	m.mutex.RLock()
+	v, ok := m.tunnels.Get(id)
+	m.mutex.RUnlock()
+	if !ok {
+		return false
+	}
+	v.(*Tunnel).KillWith(reason)
+	return true
+}
+
+// KillUser tears down all the tunnels of the user
+func (m *TunnelMap) KillUser(username string, reason string) int {
+	m.mutex.RLock()
+	var tunnels []*Tunnel
+	for _, v := range m.tunnels.Values() {
+		t := v.(*Tunnel)
+		if t.Username == username {
+			tunnels = append(tunnels, t)
+		}
+	}
+	m.mutex.RUnlock()
+	for _, t := range tunnels {
+		t.KillWith(reason)
+	}
+	return len(tunnels)
+}
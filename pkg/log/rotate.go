@@ -0,0 +1,57 @@
+package log
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// RotatingFile is a log file rotated by size, and also every interval if it is not zero.
+// Rotated files are named after the time of the rotation and optionally gzipped.
+type RotatingFile struct {
+	*lumberjack.Logger
+	stop chan struct{}
+}
+
+// NewRotatingFile opens filename, maxSize is in megabytes and maxAge in days, 0 keeps the lumberjack defaults
+func NewRotatingFile(filename string, maxSize int, maxBackups int, maxAge int, compress bool, interval time.Duration) *RotatingFile {
+	file := &RotatingFile{
+		Logger: &lumberjack.Logger{
+			Filename:   filename,
+			MaxSize:    maxSize,
+			MaxBackups: maxBackups,
+			MaxAge:     maxAge,
+			LocalTime:  true,
+			Compress:   compress,
+		},
+		stop: make(chan struct{}),
+	}
+	if interval > 0 {
+		go file.rotateEvery(interval)
+	}
+	return file
+}
+
+// rotateEvery rotates the file at the multiples of interval since the zero time, such as at midnight UTC for a day
+func (file *RotatingFile) rotateEvery(interval time.Duration) {
+	for {
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(interval).Add(interval).Sub(now))
+		select {
+		case <-timer.C:
+			err := file.Rotate()
+			if err != nil {
+				logrus.WithField("file", file.Filename).Error(err)
+			}
+		case <-file.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (file *RotatingFile) Close() error {
+	close(file.stop)
+	return file.Logger.Close()
+}
@@ -0,0 +1,116 @@
+package log
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	FormatXML  = "xml"
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// levelWriter is an output which keeps the level of the entries, such as syslog
+type levelWriter interface {
+	WriteLevel(level logrus.Level, p []byte) error
+}
+
+func NewFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case FormatXML, "":
+		return XMLFormatter{}, nil
+	case FormatJSON:
+		return &logrus.JSONFormatter{}, nil
+	case FormatText:
+		return &logrus.TextFormatter{
+			DisableColors: true,
+			FullTimestamp: true,
+		}, nil
+	default:
+		return nil, errors.New("unknown log format: " + format)
+	}
+}
+
+// LevelHook passes the entries up to its level to a hook, the level can be changed while logging
+type LevelHook struct {
+	hook  logrus.Hook
+	level uint32
+}
+
+func NewLevelHook(hook logrus.Hook, level logrus.Level) *LevelHook {
+	return &LevelHook{
+		hook:  hook,
+		level: uint32(level),
+	}
+}
+
+func (hook *LevelHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook *LevelHook) Fire(entry *logrus.Entry) error {
+	if entry.Level > hook.Level() {
+		return nil
+	}
+	return hook.hook.Fire(entry)
+}
+
+func (hook *LevelHook) Level() logrus.Level {
+	return logrus.Level(atomic.LoadUint32(&hook.level))
+}
+
+func (hook *LevelHook) SetLevel(level logrus.Level) {
+	atomic.StoreUint32(&hook.level, uint32(level))
+}
+
+// Close closes the output of the hook if it has one
+func (hook *LevelHook) Close() error {
+	if closer, ok := hook.hook.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// WriterHook formats the entries and writes them to an output
+type WriterHook struct {
+	mutex     sync.Mutex
+	out       io.Writer
+	formatter logrus.Formatter
+}
+
+func NewWriterHook(out io.Writer, formatter logrus.Formatter) *WriterHook {
+	return &WriterHook{
+		out:       out,
+		formatter: formatter,
+	}
+}
+
+func (hook *WriterHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook *WriterHook) Fire(entry *logrus.Entry) error {
+	buf, err := hook.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	if lw, ok := hook.out.(levelWriter); ok {
+		return lw.WriteLevel(entry.Level, buf)
+	}
+	_, err = hook.out.Write(buf)
+	return err
+}
+
+func (hook *WriterHook) Close() error {
+	if closer, ok := hook.out.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
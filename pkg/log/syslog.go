@@ -0,0 +1,50 @@
+// +build !windows,!plan9
+
+package log
+
+import (
+	"io"
+	"log/syslog"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// syslogWriter sends the entries to syslog with the severity of their level
+type syslogWriter struct {
+	*syslog.Writer
+}
+
+// NewSyslog connects to the local syslog, or to the unix socket addr if it is not empty
+func NewSyslog(addr string, tag string) (io.WriteCloser, error) {
+	var w *syslog.Writer
+	var err error
+	if addr == "" {
+		w, err = syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	} else {
+		w, err = syslog.Dial("unixgram", addr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+		if err != nil {
+			w, err = syslog.Dial("unix", addr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return syslogWriter{w}, nil
+}
+
+func (w syslogWriter) WriteLevel(level logrus.Level, p []byte) error {
+	msg := strings.TrimSuffix(string(p), "\n")
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return w.Crit(msg)
+	case logrus.ErrorLevel:
+		return w.Err(msg)
+	case logrus.WarnLevel:
+		return w.Warning(msg)
+	case logrus.InfoLevel:
+		return w.Info(msg)
+	default:
+		return w.Debug(msg)
+	}
+}
@@ -0,0 +1,12 @@
+// +build windows plan9
+
+package log
+
+import (
+	"errors"
+	"io"
+)
+
+func NewSyslog(addr string, tag string) (io.WriteCloser, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,106 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	schemaLockID    = 1
+	schemaLockRetry = time.Second
+	schemaLockStale = 10 * time.Minute //a lock not refreshed for this long was left by a node which died
+)
+
+var ErrSchemaLockLost = errors.New("schema lock taken over by another node")
+
+// SchemaLock is the single row leased by the node changing the schema, so that the nodes starting
+// together migrate the database once. The lease is taken with a conditional update rather than a
+// transaction, since MySQL commits the transaction on every schema change.
+type SchemaLock struct {
+	ID       uint   `gorm:"primaryKey;autoIncrement:false"`
+	Owner    string `gorm:"not null"`
+	LockedAt time.Time
+}
+
+type schemaLock struct {
+	db    *gorm.DB
+	owner string
+}
+
+// lockSchema waits until the schema lock is free, or stale, and takes it
+func lockSchema(db *gorm.DB) (*schemaLock, error) {
+	err := db.AutoMigrate(&SchemaLock{})
+	if err != nil && !db.Migrator().HasTable(&SchemaLock{}) {
+		return nil, err
+	}
+	var count int64
+	err = db.Model(&SchemaLock{}).Where("id = ?", schemaLockID).Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		err = db.Create(&SchemaLock{ID: schemaLockID}).Error
+		if err != nil {
+			//created by another node in the meantime
+			err = db.Model(&SchemaLock{}).Where("id = ?", schemaLockID).Count(&count).Error
+			if err != nil || count == 0 {
+				return nil, fmt.Errorf("creating schema lock: %w", err)
+			}
+		}
+	}
+	host, _ := os.Hostname()
+	lock := &schemaLock{
+		db:    db,
+		owner: fmt.Sprintf("%s/%d/%d", host, os.Getpid(), time.Now().UnixNano()),
+	}
+	waiting := false
+	for {
+		now := time.Now()
+		result := db.Model(&SchemaLock{}).
+			Where("id = ? AND (owner = ? OR locked_at < ?)", schemaLockID, "", now.Add(-schemaLockStale)).
+			Updates(map[string]interface{}{
+				"owner":     lock.owner,
+				"locked_at": now,
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return lock, nil
+		}
+		if !waiting {
+			log.Info("waiting for another node to finish migrating the database")
+			waiting = true
+		}
+		time.Sleep(schemaLockRetry)
+	}
+}
+
+// refresh extends the lease, it fails if the lock has been taken over
+func (lock *schemaLock) refresh() error {
+	result := lock.db.Model(&SchemaLock{}).
+		Where("id = ? AND owner = ?", schemaLockID, lock.owner).
+		Update("locked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSchemaLockLost
+	}
+	return nil
+}
+
+// unlock releases the lock if it is still held
+func (lock *schemaLock) unlock() {
+	err := lock.db.Model(&SchemaLock{}).
+		Where("id = ? AND owner = ?", schemaLockID, lock.owner).
+		Update("owner", "").Error
+	if err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,237 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSchemaTooNew  = errors.New("database schema is newer than this version of relaybaton")
+	ErrNoMigration   = errors.New("no migration to roll back")
+	ErrInitialSchema = errors.New("the initial schema cannot be rolled back")
+)
+
+// Migration is a versioned change of the database schema.
+// Up and Down run in a transaction together with the update of the schema_migrations table,
+// they must only use the structs declared with the migration, never the ones of the model package,
+// so that the migration keeps doing the same thing as the model changes.
+type Migration struct {
+	Version     uint
+	Description string
+	Up          func(tx *gorm.DB) error
+	Down        func(tx *gorm.DB) error
+}
+
+// SchemaMigration records a migration applied to the database
+type SchemaMigration struct {
+	Version     uint   `gorm:"primaryKey;autoIncrement:false"`
+	Description string `gorm:"not null"`
+	AppliedAt   time.Time
+}
+
+// Status is the state of a migration in the database
+type Status struct {
+	Version     uint       `json:"version"`
+	Description string     `json:"description"`
+	Applied     bool       `json:"applied"`
+	AppliedAt   *time.Time `json:"applied_at"`
+}
+
+// migrations are ordered by version, new migrations are appended with the next version
+var migrations = []Migration{
+	v1,
+	v2,
+	v3,
+	v4,
+	v5,
+	v6,
+}
+
+// Latest returns the version of the schema expected by this build
+func Latest() uint {
+	return migrations[len(migrations)-1].Version
+}
+
+func applied(db *gorm.DB) ([]SchemaMigration, error) {
+	err := db.AutoMigrate(&SchemaMigration{})
+	if err != nil {
+		return nil, err
+	}
+	var records []SchemaMigration
+	err = db.Order("version").Find(&records).Error
+	return records, err
+}
+
+// Current returns the version of the schema in the database, 0 for an empty database
+func Current(db *gorm.DB) (uint, error) {
+	records, err := applied(db)
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	return records[len(records)-1].Version, nil
+}
+
+// Check refuses a database migrated by a newer version of relaybaton
+func Check(db *gorm.DB) error {
+	current, err := Current(db)
+	if err != nil {
+		return err
+	}
+	if current > Latest() {
+		return fmt.Errorf("%w: %d > %d", ErrSchemaTooNew, current, Latest())
+	}
+	return nil
+}
+
+// Migrate applies the migrations which are not applied yet, in order, and returns them.
+// The schema is locked first, a node which waited for the lock finds the migrations applied by the other node.
+func Migrate(db *gorm.DB) ([]Migration, error) {
+	lock, err := lockSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.unlock()
+	err = Check(db)
+	if err != nil {
+		return nil, err
+	}
+	current, err := Current(db)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		err = lock.refresh()
+		if err != nil {
+			return done, err
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := m.Up(tx)
+			if err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{
+				Version:     m.Version,
+				Description: m.Description,
+				AppliedAt:   time.Now(),
+			}).Error
+		})
+		if err != nil {
+			log.WithField("version", m.Version).Error(err)
+			return done, err
+		}
+		log.WithFields(log.Fields{
+			"version":     m.Version,
+			"description": m.Description,
+		}).Info("migration applied")
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Rollback reverts the last steps migrations applied to the database and returns them
+func Rollback(db *gorm.DB, steps int) ([]Migration, error) {
+	lock, err := lockSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.unlock()
+	err = Check(db)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := 0; i < steps; i++ {
+		err = lock.refresh()
+		if err != nil {
+			return done, err
+		}
+		current, err := Current(db)
+		if err != nil {
+			return done, err
+		}
+		if current == 0 {
+			return done, ErrNoMigration
+		}
+		if current == v1.Version {
+			return done, ErrInitialSchema
+		}
+		m, ok := find(current)
+		if !ok {
+			return done, fmt.Errorf("unknown migration: %d", current)
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := m.Down(tx)
+			if err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			log.WithField("version", m.Version).Error(err)
+			return done, err
+		}
+		log.WithFields(log.Fields{
+			"version":     m.Version,
+			"description": m.Description,
+		}).Info("migration rolled back")
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Statuses returns the state of every known migration, followed by the unknown ones found in the database
+func Statuses(db *gorm.DB) ([]Status, error) {
+	records, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := map[uint]SchemaMigration{}
+	for _, record := range records {
+		appliedAt[record.Version] = record
+	}
+	statuses := make([]Status, 0, len(migrations))
+	for _, m := range migrations {
+		status := Status{
+			Version:     m.Version,
+			Description: m.Description,
+		}
+		if record, ok := appliedAt[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &record.AppliedAt
+			delete(appliedAt, m.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, record := range records {
+		if _, ok := appliedAt[record.Version]; ok {
+			record := record
+			statuses = append(statuses, Status{
+				Version:     record.Version,
+				Description: record.Description,
+				Applied:     true,
+				AppliedAt:   &record.AppliedAt,
+			})
+		}
+	}
+	return statuses, nil
+}
+
+func find(version uint) (Migration, bool) {
+	for _, m := range migrations {
+		if m.Version == version {
+			return m, true
+		}
+	}
+	return Migration{}, false
+}
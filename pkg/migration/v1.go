@@ -0,0 +1,164 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v1 is the schema created by AutoMigrate before versioned migrations were introduced.
+// It is applied with AutoMigrate as well, so that such databases are adopted as they are.
+// It cannot be rolled back.
+var v1 = Migration{
+	Version:     1,
+	Description: "initial schema",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(v1Tables()...)
+	},
+	//dropping the tables would delete all the data, the schema is removed by hand if ever needed
+	Down: func(tx *gorm.DB) error {
+		return ErrInitialSchema
+	},
+}
+
+func v1Tables() []interface{} {
+	return []interface{}{
+		&v1Plan{},
+		&v1User{},
+		&v1Log{},
+		&v1Meta{},
+		&v1Notice{},
+		&v1TrafficReset{},
+		&v1Connection{},
+		&v1Node{},
+		&v1NodeUser{},
+	}
+}
+
+type v1Plan struct {
+	gorm.Model
+	Name              string `gorm:"unique;not null"`
+	BandwidthLimit    uint   `gorm:"not null"`
+	TrafficLimit      uint   `gorm:"not null"`
+	MaxConnections    uint   `gorm:"not null;default:0"`
+	MaxDevices        uint   `gorm:"not null;default:0"`
+	CycleDays         uint   `gorm:"not null;default:0"`
+	DurationDays      uint   `gorm:"not null;default:0"`
+	ExpiredPlanID     uint   `gorm:"not null;default:0"`
+	AllowUDP          bool   `gorm:"not null;default:false"`
+	PortRanges        string
+	BlockedCategories string
+	MaxDuration       uint `gorm:"not null;default:0"`
+}
+
+func (v1Plan) TableName() string {
+	return "plans"
+}
+
+type v1User struct {
+	gorm.Model
+	Username    string `gorm:"unique;not null"`
+	Role        uint   `gorm:"not null;default:0"`
+	Plan        v1Plan `gorm:"foreignKey:PlanID"`
+	PlanID      uint
+	Password    string    `gorm:"not null"`
+	TrafficUsed uint      `gorm:"not null"`
+	PlanStart   time.Time `gorm:"not null"`
+	PlanReset   time.Time `gorm:"not null"`
+	PlanEnd     time.Time `gorm:"not null"`
+	Disabled    bool      `gorm:"not null;default:false"`
+}
+
+func (v1User) TableName() string {
+	return "users"
+}
+
+type v1Log struct {
+	gorm.Model
+	Level  uint32
+	Func   string
+	File   string
+	Msg    string
+	Stack  string
+	Fields string
+}
+
+func (v1Log) TableName() string {
+	return "log"
+}
+
+type v1Meta struct {
+	gorm.Model
+	Title string
+	Desc  string
+}
+
+func (v1Meta) TableName() string {
+	return "meta"
+}
+
+type v1Notice struct {
+	gorm.Model
+	Title string `gorm:"unique;not null"`
+	Text  string
+}
+
+func (v1Notice) TableName() string {
+	return "notices"
+}
+
+type v1TrafficReset struct {
+	gorm.Model
+	UserID      uint   `gorm:"index;not null"`
+	PlanID      uint   `gorm:"not null"`
+	TrafficUsed uint   `gorm:"not null"`
+	Reason      string `gorm:"not null"`
+}
+
+func (v1TrafficReset) TableName() string {
+	return "traffic_resets"
+}
+
+type v1Connection struct {
+	gorm.Model
+	UserID      uint   `gorm:"index;not null"`
+	Username    string `gorm:"index;not null"`
+	ClientIP    string `gorm:"index"`
+	Addr        string
+	Domain      string
+	StartedAt   time.Time `gorm:"index;not null"`
+	EndedAt     time.Time `gorm:"not null"`
+	Up          uint64    `gorm:"not null"`
+	Down        uint64    `gorm:"not null"`
+	CloseReason string
+}
+
+func (v1Connection) TableName() string {
+	return "connections"
+}
+
+type v1Node struct {
+	gorm.Model
+	Name          string    `gorm:"unique;not null;size:255"`
+	Enabled       bool      `gorm:"not null;default:true"`
+	Draining      bool      `gorm:"not null;default:false"`
+	Connections   uint      `gorm:"not null;default:0"`
+	Up            uint64    `gorm:"not null;default:0"`
+	Down          uint64    `gorm:"not null;default:0"`
+	StartedAt     time.Time `gorm:"not null"`
+	LastHeartbeat time.Time `gorm:"index;not null"`
+}
+
+func (v1Node) TableName() string {
+	return "nodes"
+}
+
+type v1NodeUser struct {
+	NodeID      uint   `gorm:"primaryKey;autoIncrement:false"`
+	Username    string `gorm:"primaryKey;size:255"`
+	Connections uint   `gorm:"not null"`
+}
+
+func (v1NodeUser) TableName() string {
+	return "node_users"
+}
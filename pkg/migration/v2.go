@@ -0,0 +1,42 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var v2 = Migration{
+	Version:     2,
+	Description: "sessions and session keys",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&v2Session{}, &v2SessionKey{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v2SessionKey{}, &v2Session{})
+	},
+}
+
+type v2Session struct {
+	gorm.Model
+	Token     string `gorm:"unique;not null;size:64"`
+	UserID    uint   `gorm:"index;not null;default:0"`
+	Username  string `gorm:"index"`
+	Data      []byte
+	ClientIP  string
+	UserAgent string
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+func (v2Session) TableName() string {
+	return "sessions"
+}
+
+type v2SessionKey struct {
+	gorm.Model
+	Secret string `gorm:"not null"`
+}
+
+func (v2SessionKey) TableName() string {
+	return "session_keys"
+}
@@ -0,0 +1,45 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var v3 = Migration{
+	Version:     3,
+	Description: "password changes and reset tokens",
+	Up: func(tx *gorm.DB) error {
+		err := tx.Migrator().AddColumn(&v3User{}, "PasswordChangedAt")
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().CreateTable(&v3PasswordReset{})
+	},
+	Down: func(tx *gorm.DB) error {
+		err := tx.Migrator().DropTable(&v3PasswordReset{})
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&v3User{}, "PasswordChangedAt")
+	},
+}
+
+type v3User struct {
+	PasswordChangedAt *time.Time
+}
+
+func (v3User) TableName() string {
+	return "users"
+}
+
+type v3PasswordReset struct {
+	gorm.Model
+	UserID    uint      `gorm:"index;not null"`
+	TokenHash string    `gorm:"unique;not null;size:64"`
+	ExpiresAt time.Time `gorm:"not null"`
+}
+
+func (v3PasswordReset) TableName() string {
+	return "password_resets"
+}
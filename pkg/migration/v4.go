@@ -0,0 +1,33 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var v4 = Migration{
+	Version:     4,
+	Description: "API tokens",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&v4APIToken{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v4APIToken{})
+	},
+}
+
+type v4APIToken struct {
+	gorm.Model
+	Name       string     `gorm:"not null;size:255"`
+	TokenHash  string     `gorm:"unique;not null;size:64"`
+	Prefix     string     `gorm:"not null;size:16"`
+	Scopes     string     `gorm:"not null"`
+	CreatedBy  string     `gorm:"not null;size:255"`
+	ExpiresAt  *time.Time `gorm:"index"`
+	LastUsedAt *time.Time
+}
+
+func (v4APIToken) TableName() string {
+	return "api_tokens"
+}
@@ -0,0 +1,29 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var v5 = Migration{
+	Version:     5,
+	Description: "runtime settings",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&v5Setting{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v5Setting{})
+	},
+}
+
+type v5Setting struct {
+	Name      string    `gorm:"primaryKey;size:255"`
+	Value     string    `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"index"`
+	UpdatedBy string    `gorm:"not null;size:255"`
+}
+
+func (v5Setting) TableName() string {
+	return "settings"
+}
@@ -0,0 +1,35 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var v6 = Migration{
+	Version:     6,
+	Description: "log indexes for filtering and retention",
+	Up: func(tx *gorm.DB) error {
+		err := tx.Migrator().CreateIndex(&v6Log{}, "Level")
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().CreateIndex(&v6Log{}, "CreatedAt")
+	},
+	Down: func(tx *gorm.DB) error {
+		err := tx.Migrator().DropIndex(&v6Log{}, "CreatedAt")
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropIndex(&v6Log{}, "Level")
+	},
+}
+
+type v6Log struct {
+	CreatedAt time.Time `gorm:"index"`
+	Level     uint32    `gorm:"index"`
+}
+
+func (v6Log) TableName() string {
+	return "log"
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ScopeRead      = "read"       //GET requests of the web API
+	ScopeUserAdmin = "user-admin" //any request on users and plans, including ScopeRead
+)
+
+// APIToken is a long-lived credential of the web API, sent as "Authorization: Bearer <token>"
+type APIToken struct {
+	gorm.Model
+	Name       string     `gorm:"not null;size:255"`
+	TokenHash  string     `gorm:"unique;not null;size:64"` //hex SHA-256 of the token, the token itself is only shown once
+	Prefix     string     `gorm:"not null;size:16"`        //first characters of the token to tell the tokens apart
+	Scopes     string     `gorm:"not null"`                //comma separated
+	CreatedBy  string     `gorm:"not null;size:255"`
+	ExpiresAt  *time.Time `gorm:"index"` //nil if the token never expires
+	LastUsedAt *time.Time
+}
+
+func ValidScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeUserAdmin
+}
+
+func (token APIToken) ScopeList() []string {
+	if token.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(token.Scopes, ",")
+}
+
+func (token APIToken) HasScope(scope string) bool {
+	for _, v := range token.ScopeList() {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (token APIToken) Expired(now time.Time) bool {
+	return token.ExpiresAt != nil && !now.Before(*token.ExpiresAt)
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	CloseReasonClient      = "client"
+	CloseReasonDestination = "destination"
+	CloseReasonQuota       = "quota"
+	CloseReasonExpired     = "expired"
+	CloseReasonMaxDuration = "max_duration"
+	CloseReasonAdmin       = "admin"
+	CloseReasonError       = "error"
+)
+
+// Connection records a tunnel relayed by the server
+type Connection struct {
+	gorm.Model
+	UserID      uint      `gorm:"index;not null"`
+	Username    string    `gorm:"index;not null"`
+	ClientIP    string    `gorm:"index"`
+	Addr        string    //destination address, empty when server.hide_destination is set
+	Domain      string    //destination domain requested by the client, empty when server.hide_destination is set
+	StartedAt   time.Time `gorm:"index;not null"`
+	EndedAt     time.Time `gorm:"not null"`
+	Up          uint64    `gorm:"not null"`
+	Down        uint64    `gorm:"not null"`
+	CloseReason string
+}
@@ -11,7 +11,7 @@ import (
 
 type Log struct {
 	gorm.Model
-	Level  uint32
+	Level  uint32 `gorm:"index"`
 	Func   string
 	File   string
 	Msg    string
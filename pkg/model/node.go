@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Node is a relay server sharing the database with the other nodes of the cluster
+type Node struct {
+	gorm.Model
+	Name          string    `gorm:"unique;not null;size:255"`
+	Enabled       bool      `gorm:"not null;default:true"`  //disabled nodes refuse new tunnels
+	Draining      bool      `gorm:"not null;default:false"` //draining nodes refuse new tunnels and keep the open ones
+	Connections   uint      `gorm:"not null;default:0"`     //open tunnels at the last heartbeat
+	Up            uint64    `gorm:"not null;default:0"`     //bytes from clients to destinations since the node started
+	Down          uint64    `gorm:"not null;default:0"`     //bytes from destinations to clients since the node started
+	StartedAt     time.Time `gorm:"not null"`
+	LastHeartbeat time.Time `gorm:"index;not null"`
+}
+
+// Accepting reports whether the node opens new tunnels
+func (node Node) Accepting() bool {
+	return node.Enabled && !node.Draining
+}
+
+// NodeUser is the number of tunnels a user has open on a node at its last heartbeat
+type NodeUser struct {
+	NodeID      uint   `gorm:"primaryKey;autoIncrement:false"`
+	Username    string `gorm:"primaryKey;size:255"`
+	Connections uint   `gorm:"not null"`
+}
@@ -0,0 +1,15 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PasswordReset is a one-time token issued by an admin to set the password of a user
+type PasswordReset struct {
+	gorm.Model
+	UserID    uint      `gorm:"index;not null"`
+	TokenHash string    `gorm:"unique;not null;size:64"` //hex SHA-256 of the token, the token itself is only shown once
+	ExpiresAt time.Time `gorm:"not null"`
+}
@@ -1,10 +1,84 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"strings"
+	"time"
+
+	"github.com/iyouport-org/relaybaton/pkg/util"
+	"gorm.io/gorm"
+)
 
 type Plan struct {
 	gorm.Model
-	Name           string `gorm:"unique;not null"`
-	BandwidthLimit uint   `gorm:"not null"`
-	TrafficLimit   uint   `gorm:"not null"`
+	Name              string `gorm:"unique;not null"`
+	BandwidthLimit    uint   `gorm:"not null"` //KB/s shared by upload and download, 0 for unlimited
+	TrafficLimit      uint   `gorm:"not null"`
+	MaxConnections    uint   `gorm:"not null;default:0"` //concurrent tunnels per user, 0 for unlimited
+	MaxDevices        uint   `gorm:"not null;default:0"` //distinct client IPs per user, 0 for unlimited
+	CycleDays         uint   `gorm:"not null;default:0"` //days between traffic resets, 0 for never
+	DurationDays      uint   `gorm:"not null;default:0"` //days before the plan expires, 0 for never
+	ExpiredPlanID     uint   `gorm:"not null;default:0"` //plan to downgrade to when expired, 0 to disable the user
+	AllowUDP          bool   `gorm:"not null;default:false"`
+	PortRanges        string //comma separated destination ports or port ranges, empty for all
+	BlockedCategories string //comma separated destination categories defined in server.categories
+	MaxDuration       uint   `gorm:"not null;default:0"` //seconds a tunnel can last, 0 for unlimited
+}
+
+// NextReset returns the time of the first traffic reset after from
+func (plan Plan) NextReset(from time.Time) time.Time {
+	if plan.CycleDays == 0 {
+		return from
+	}
+	return from.AddDate(0, 0, int(plan.CycleDays))
+}
+
+// End returns the time when the plan started at from expires
+func (plan Plan) End(from time.Time) time.Time {
+	if plan.DurationDays == 0 {
+		return from
+	}
+	return from.AddDate(0, 0, int(plan.DurationDays))
+}
+
+// AllowedPorts returns the destination port ranges of the plan, nil for all ports
+func (plan Plan) AllowedPorts() []util.PortRange {
+	var ranges []util.PortRange
+	for _, s := range splitList(plan.PortRanges) {
+		pr, err := util.ParsePortRange(s)
+		if err != nil {
+			continue
+		}
+		ranges = append(ranges, pr)
+	}
+	return ranges
+}
+
+// AllowPort reports whether the plan allows connecting to the destination port
+func (plan Plan) AllowPort(port uint16) bool {
+	ranges := plan.AllowedPorts()
+	if len(ranges) == 0 {
+		return true
+	}
+	for _, pr := range ranges {
+		if pr.Contains(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// BlockedCategoryList returns the destination categories blocked by the plan
+func (plan Plan) BlockedCategoryList() []string {
+	return splitList(plan.BlockedCategories)
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
 }
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is a web API session kept in the database by the db session store
+type Session struct {
+	gorm.Model
+	Token     string `gorm:"unique;not null;size:64"` //carried by the signed session cookie
+	UserID    uint   `gorm:"index;not null;default:0"`
+	Username  string `gorm:"index"` //empty until the visitor logs in
+	Data      []byte //values of the session
+	ClientIP  string
+	UserAgent string
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+// SessionKey is a secret which the session keys are derived from, shared by the nodes.
+// The newest key signs the sessions, the others still verify them.
+type SessionKey struct {
+	gorm.Model
+	Secret string `gorm:"not null"`
+}
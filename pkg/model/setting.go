@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// Setting overrides a key of the configuration file at runtime, shared by the nodes
+type Setting struct {
+	Name      string    `gorm:"primaryKey;size:255"` //key of the configuration file
+	Value     string    `gorm:"not null"`            //JSON
+	UpdatedAt time.Time `gorm:"index"`
+	UpdatedBy string    `gorm:"not null;size:255"`
+}
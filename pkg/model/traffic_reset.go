@@ -0,0 +1,18 @@
+package model
+
+import "gorm.io/gorm"
+
+const (
+	ResetReasonCycle  = "cycle"
+	ResetReasonExpire = "expire"
+	ResetReasonManual = "manual"
+)
+
+// TrafficReset records the traffic of a user before it was reset
+type TrafficReset struct {
+	gorm.Model
+	UserID      uint   `gorm:"index;not null"`
+	PlanID      uint   `gorm:"not null"`
+	TrafficUsed uint   `gorm:"not null"`
+	Reason      string `gorm:"not null"`
+}
@@ -1,8 +1,10 @@
 package model
 
 import (
+	"encoding/base64"
 	"time"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -21,6 +23,38 @@ type User struct {
 	Password    string    `gorm:"not null"`
 	TrafficUsed uint      `gorm:"not null"`
 	PlanStart   time.Time `gorm:"not null"`
-	PlanReset   time.Time `gorm:"not null"`
-	PlanEnd     time.Time `gorm:"not null"`
+	PlanReset   time.Time `gorm:"not null"` //time of the next traffic reset
+	PlanEnd     time.Time `gorm:"not null"` //time when the plan expires
+	Disabled    bool      `gorm:"not null;default:false"`
+
+	PasswordChangedAt *time.Time //sessions started before are invalid, nil if the password never changed
+}
+
+// SetPassword stores the bcrypt hash of sha512key, the SHA-512 digest of the password sent by the clients
+func (user *User) SetPassword(sha512key []byte) error {
+	cryptKey, err := bcrypt.GenerateFromPassword(sha512key, bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.Password = base64.StdEncoding.EncodeToString(cryptKey)
+	return nil
+}
+
+// CheckPassword compares sha512key with the password of the user
+func (user *User) CheckPassword(sha512key []byte) error {
+	cryptKey, err := base64.StdEncoding.DecodeString(user.Password)
+	if err != nil {
+		return err
+	}
+	return bcrypt.CompareHashAndPassword(cryptKey, sha512key)
+}
+
+// StartPlan subscribes the user to the plan from now on
+func (user *User) StartPlan(plan Plan, now time.Time) {
+	user.Plan = plan
+	user.PlanID = plan.ID
+	user.TrafficUsed = 0
+	user.PlanStart = now
+	user.PlanReset = plan.NextReset(now)
+	user.PlanEnd = plan.End(now)
 }
@@ -0,0 +1,46 @@
+package util
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// PortRange is an inclusive range of ports, such as "6881-6889" or a single port "25"
+type PortRange struct {
+	From uint16
+	To   uint16
+}
+
+func ParsePortRange(s string) (PortRange, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "-", 2)
+	from, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 16)
+	if err != nil {
+		return PortRange{}, err
+	}
+	to := from
+	if len(parts) == 2 {
+		to, err = strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 16)
+		if err != nil {
+			return PortRange{}, err
+		}
+	}
+	if from > to {
+		return PortRange{}, errors.New("invalid port range: " + s)
+	}
+	return PortRange{
+		From: uint16(from),
+		To:   uint16(to),
+	}, nil
+}
+
+func (pr PortRange) Contains(port uint16) bool {
+	return port >= pr.From && port <= pr.To
+}
+
+func (pr PortRange) String() string {
+	if pr.From == pr.To {
+		return strconv.Itoa(int(pr.From))
+	}
+	return strconv.Itoa(int(pr.From)) + "-" + strconv.Itoa(int(pr.To))
+}
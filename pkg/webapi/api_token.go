@@ -0,0 +1,51 @@
+package webapi
+
+import (
+	"time"
+
+	"github.com/iyouport-org/relaybaton/pkg/model"
+)
+
+type PostAPITokenRequest struct {
+	Name      string   `json:"name" validate:"required,max=255"`
+	Scopes    []string `json:"scopes" validate:"required,min=1,dive,oneof=read user-admin"`
+	ExpiresIn uint     `json:"expires_in"` //seconds, 0 for never
+}
+
+type APIToken struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// PostAPITokenResponse carries the token, which is not stored and cannot be shown again
+type PostAPITokenResponse struct {
+	APIToken
+	Token string `json:"token"`
+}
+
+func GetAPIToken(token model.APIToken) APIToken {
+	return APIToken{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.ScopeList(),
+		CreatedBy:  token.CreatedBy,
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+	}
+}
+
+func GetAPITokens(tokens []model.APIToken) []APIToken {
+	ret := make([]APIToken, len(tokens))
+	for k, v := range tokens {
+		ret[k] = GetAPIToken(v)
+	}
+	return ret
+}
@@ -1,19 +1,36 @@
 package webapi
 
-type PostConfigRequest struct {
-}
+import (
+	"encoding/json"
 
-type PostConfigResponse struct {
-}
+	"github.com/iyouport-org/relaybaton/pkg/config"
+)
 
-type DeleteConfigRequest struct {
+// Config is the effective configuration of the server with the secrets redacted
+type Config struct {
+	Config   *config.ConfigTOML         `json:"config"`
+	Settings map[string]json.RawMessage `json:"settings"` //runtime settings overriding the configuration file
+	Runtime  []string                   `json:"runtime"`  //keys which can be set at runtime
 }
 
-type DeleteConfigResponse struct {
+// PostConfigResponse lists the changed keys of the reloaded configuration file which need a restart
+type PostConfigResponse struct {
+	Restart []string `json:"restart"`
 }
 
 type PutConfigRequest struct {
+	Settings map[string]json.RawMessage `json:"settings" validate:"required"`
 }
 
-type PutConfigResponse struct {
+func GetConfig(conf *config.ConfigGo) Config {
+	settings := conf.Settings()
+	ret := Config{
+		Config:   conf.Redacted(),
+		Settings: make(map[string]json.RawMessage, len(settings)),
+		Runtime:  config.RuntimeSettings(),
+	}
+	for key, value := range settings {
+		ret.Settings[key] = json.RawMessage(value)
+	}
+	return ret
 }
@@ -0,0 +1,45 @@
+package webapi
+
+import (
+	"time"
+
+	"github.com/iyouport-org/relaybaton/pkg/model"
+)
+
+type Connection struct {
+	ID          uint      `json:"id"`
+	UserID      uint      `json:"user_id"`
+	Username    string    `json:"username"`
+	ClientIP    string    `json:"client_ip"`
+	Addr        string    `json:"addr"`
+	Domain      string    `json:"domain"`
+	StartedAt   time.Time `json:"started_at"`
+	EndedAt     time.Time `json:"ended_at"`
+	Up          uint64    `json:"up"`
+	Down        uint64    `json:"down"`
+	CloseReason string    `json:"close_reason"`
+}
+
+func GetConnection(connection model.Connection) Connection {
+	return Connection{
+		ID:          connection.ID,
+		UserID:      connection.UserID,
+		Username:    connection.Username,
+		ClientIP:    connection.ClientIP,
+		Addr:        connection.Addr,
+		Domain:      connection.Domain,
+		StartedAt:   connection.StartedAt,
+		EndedAt:     connection.EndedAt,
+		Up:          connection.Up,
+		Down:        connection.Down,
+		CloseReason: connection.CloseReason,
+	}
+}
+
+func GetConnections(connections []model.Connection) []Connection {
+	ret := make([]Connection, len(connections))
+	for k, v := range connections {
+		ret[k] = GetConnection(v)
+	}
+	return ret
+}
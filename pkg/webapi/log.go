@@ -12,10 +12,8 @@ type PostLogRequest struct {
 type PostLogResponse struct {
 }
 
-type DeleteLogRequest struct {
-}
-
 type DeleteLogResponse struct {
+	Deleted int64 `json:"deleted"`
 }
 
 type PutLogRequest struct {
@@ -0,0 +1,50 @@
+package webapi
+
+import (
+	"time"
+
+	"github.com/iyouport-org/relaybaton/pkg/model"
+)
+
+type Node struct {
+	ID            uint      `json:"id"`
+	Name          string    `json:"name"`
+	Enabled       bool      `json:"enabled"`
+	Draining      bool      `json:"draining"`
+	Alive         bool      `json:"alive"`
+	Connections   uint      `json:"connections"`
+	Up            uint64    `json:"up"`
+	Down          uint64    `json:"down"`
+	StartedAt     time.Time `json:"started_at"`
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+}
+
+// PutNodeRequest changes the state of a node, a field which is absent is kept
+type PutNodeRequest struct {
+	Enabled  *bool `json:"enabled"`
+	Draining *bool `json:"draining"`
+}
+
+// GetNode converts node, a node is alive if its last heartbeat is more recent than timeout
+func GetNode(node model.Node, timeout time.Duration) Node {
+	return Node{
+		ID:            node.ID,
+		Name:          node.Name,
+		Enabled:       node.Enabled,
+		Draining:      node.Draining,
+		Alive:         time.Since(node.LastHeartbeat) < timeout,
+		Connections:   node.Connections,
+		Up:            node.Up,
+		Down:          node.Down,
+		StartedAt:     node.StartedAt,
+		LastHeartbeat: node.LastHeartbeat,
+	}
+}
+
+func GetNodes(nodes []model.Node, timeout time.Duration) []Node {
+	ret := make([]Node, len(nodes))
+	for k, v := range nodes {
+		ret[k] = GetNode(v, timeout)
+	}
+	return ret
+}
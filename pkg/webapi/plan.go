@@ -3,24 +3,56 @@ package webapi
 import "github.com/iyouport-org/relaybaton/pkg/model"
 
 type PostPlanRequest struct {
-	Name           string `json:"name" validate:"required"`
-	BandwidthLimit uint   `json:"bandwidth_limit" validate:"required"`
-	TrafficLimit   uint   `json:"traffic_limit" validate:"required"`
+	Name              string   `json:"name" validate:"required"`
+	BandwidthLimit    uint     `json:"bandwidth_limit" validate:"required"`
+	TrafficLimit      uint     `json:"traffic_limit" validate:"required"`
+	MaxConnections    uint     `json:"max_connections"`
+	MaxDevices        uint     `json:"max_devices"`
+	CycleDays         uint     `json:"cycle_days"`
+	DurationDays      uint     `json:"duration_days"`
+	ExpiredPlanID     uint     `json:"expired_plan_id"`
+	AllowUDP          bool     `json:"allow_udp"`
+	PortRanges        []string `json:"port_ranges"`
+	BlockedCategories []string `json:"blocked_categories"`
+	MaxDuration       uint     `json:"max_duration"`
 }
 
 type Plan struct {
-	ID             uint   `json:"id" validate:"required"`
-	Name           string `json:"name" validate:"required"`
-	BandwidthLimit uint   `json:"bandwidth_limit" validate:"required"`
-	TrafficLimit   uint   `json:"traffic_limit" validate:"required"`
+	ID                uint     `json:"id" validate:"required"`
+	Name              string   `json:"name" validate:"required"`
+	BandwidthLimit    uint     `json:"bandwidth_limit" validate:"required"`
+	TrafficLimit      uint     `json:"traffic_limit" validate:"required"`
+	MaxConnections    uint     `json:"max_connections"`
+	MaxDevices        uint     `json:"max_devices"`
+	CycleDays         uint     `json:"cycle_days"`
+	DurationDays      uint     `json:"duration_days"`
+	ExpiredPlanID     uint     `json:"expired_plan_id"`
+	AllowUDP          bool     `json:"allow_udp"`
+	PortRanges        []string `json:"port_ranges"`
+	BlockedCategories []string `json:"blocked_categories"`
+	MaxDuration       uint     `json:"max_duration"`
 }
 
 func GetPlan(plan model.Plan) Plan {
+	portRanges := []string{}
+	for _, pr := range plan.AllowedPorts() {
+		portRanges = append(portRanges, pr.String())
+	}
+	blockedCategories := append([]string{}, plan.BlockedCategoryList()...)
 	return Plan{
-		ID:             plan.ID,
-		Name:           plan.Name,
-		BandwidthLimit: plan.BandwidthLimit,
-		TrafficLimit:   plan.TrafficLimit,
+		ID:                plan.ID,
+		Name:              plan.Name,
+		BandwidthLimit:    plan.BandwidthLimit,
+		TrafficLimit:      plan.TrafficLimit,
+		MaxConnections:    plan.MaxConnections,
+		MaxDevices:        plan.MaxDevices,
+		CycleDays:         plan.CycleDays,
+		DurationDays:      plan.DurationDays,
+		ExpiredPlanID:     plan.ExpiredPlanID,
+		AllowUDP:          plan.AllowUDP,
+		PortRanges:        portRanges,
+		BlockedCategories: blockedCategories,
+		MaxDuration:       plan.MaxDuration,
 	}
 }
 
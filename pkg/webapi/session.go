@@ -1,5 +1,11 @@
 package webapi
 
+import (
+	"time"
+
+	"github.com/iyouport-org/relaybaton/pkg/model"
+)
+
 type PostSessionRequest struct {
 	Username string `json:"username" validate:"required"`
 	Password string `json:"password" validate:"base64,required"`
@@ -15,6 +21,7 @@ type DeleteSessionRequest struct {
 }
 
 type DeleteSessionResponse struct {
+	OK bool `json:"ok"`
 }
 
 type PutSessionRequest struct {
@@ -22,3 +29,66 @@ type PutSessionRequest struct {
 
 type PutSessionResponse struct {
 }
+
+// CurrentSession is the session of the logged in user
+type CurrentSession struct {
+	User          User      `json:"user"`
+	LoginAt       time.Time `json:"login_at"`
+	ExpiresAt     time.Time `json:"expires_at"`      //end of the session lifetime
+	IdleExpiresAt time.Time `json:"idle_expires_at"` //end of the session unless refreshed before
+}
+
+// ActiveSession is a tunnel which is open on the server
+type ActiveSession struct {
+	ID       uint64    `json:"id"`
+	UserID   uint      `json:"user_id"`
+	Username string    `json:"username"`
+	ClientIP string    `json:"client_ip"`
+	Addr     string    `json:"addr"`
+	Domain   string    `json:"domain"`
+	Up       uint64    `json:"up"`
+	Down     uint64    `json:"down"`
+	Start    time.Time `json:"start"`
+	Age      int64     `json:"age"` //seconds
+}
+
+type DeleteActiveSessionResponse struct {
+	Killed int `json:"killed"`
+}
+
+// WebSession is a web API session kept by the db session store
+type WebSession struct {
+	ID        uint      `json:"id"`
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	ClientIP  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type DeleteWebSessionResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+func GetWebSession(session model.Session) WebSession {
+	return WebSession{
+		ID:        session.ID,
+		UserID:    session.UserID,
+		Username:  session.Username,
+		ClientIP:  session.ClientIP,
+		UserAgent: session.UserAgent,
+		CreatedAt: session.CreatedAt,
+		LastSeen:  session.UpdatedAt,
+		ExpiresAt: session.ExpiresAt,
+	}
+}
+
+func GetWebSessions(sessions []model.Session) []WebSession {
+	ret := make([]WebSession, len(sessions))
+	for k, v := range sessions {
+		ret[k] = GetWebSession(v)
+	}
+	return ret
+}
@@ -17,6 +17,27 @@ type PostUserResponse struct {
 	ErrorMsg string `json:"errorMsg"`
 }
 
+type PutUserPasswordRequest struct {
+	OldPassword string `json:"old_password" validate:"base64,required"`
+	NewPassword string `json:"new_password" validate:"base64,required"`
+}
+
+type PutUserPasswordResponse struct {
+	OK       bool   `json:"ok"`
+	ErrorMsg string `json:"errorMsg"`
+}
+
+// PostPasswordResetResponse carries the reset token, which is not stored and cannot be shown again
+type PostPasswordResetResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type PutPasswordResetRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"base64,required"`
+}
+
 type User struct {
 	ID                 uint      `json:"id" validate:"required"`
 	Username           string    `json:"username" validate:"required"`
@@ -25,28 +46,51 @@ type User struct {
 	PlanName           string    `json:"plan_name" validate:"required"`
 	PlanBandwidthLimit uint      `json:"plan_bandwidth_limit" validate:"required"`
 	PlanTrafficLimit   uint      `json:"plan_traffic_limit" validate:"required"`
+	PlanMaxConnections uint      `json:"plan_max_connections"`
+	PlanMaxDevices     uint      `json:"plan_max_devices"`
 	TrafficUsed        uint      `json:"traffic_used" validate:"required"`
 	PlanStart          time.Time `json:"plan_start" validate:"required"`
 	PlanReset          time.Time `json:"plan_reset" validate:"required"`
 	PlanEnd            time.Time `json:"plan_end" validate:"required"`
+	Disabled           bool      `json:"disabled"`
+}
+
+func GetUser(user model.User) User {
+	return User{
+		ID:                 user.ID,
+		Username:           user.Username,
+		Role:               user.Role,
+		PlanID:             user.PlanID,
+		PlanName:           user.Plan.Name,
+		PlanBandwidthLimit: user.Plan.BandwidthLimit,
+		PlanTrafficLimit:   user.Plan.TrafficLimit,
+		PlanMaxConnections: user.Plan.MaxConnections,
+		PlanMaxDevices:     user.Plan.MaxDevices,
+		TrafficUsed:        user.TrafficUsed,
+		PlanStart:          user.PlanStart,
+		PlanReset:          user.PlanReset,
+		PlanEnd:            user.PlanEnd,
+		Disabled:           user.Disabled,
+	}
+}
+
+// GetAdminUser describes the admin, who is not in the users table
+func GetAdminUser() User {
+	now := time.Now()
+	return User{
+		ID:        0,
+		Username:  "admin",
+		Role:      model.RoleAdmin,
+		PlanStart: now,
+		PlanReset: now,
+		PlanEnd:   now,
+	}
 }
 
 func GetUsers(users []model.User) []User {
 	ret := make([]User, len(users))
 	for k, v := range users {
-		ret[k] = User{
-			ID:                 v.ID,
-			Username:           v.Username,
-			Role:               v.Role,
-			PlanID:             v.PlanID,
-			PlanName:           v.Plan.Name,
-			PlanBandwidthLimit: v.Plan.BandwidthLimit,
-			PlanTrafficLimit:   v.Plan.TrafficLimit,
-			TrafficUsed:        v.TrafficUsed,
-			PlanStart:          v.PlanStart,
-			PlanReset:          v.PlanReset,
-			PlanEnd:            v.PlanEnd,
-		}
+		ret[k] = GetUser(v)
 	}
 	return ret
 }